@@ -9,14 +9,10 @@ import (
 	"os"
 
 	"github.com/mvdan/sh/interp"
-	"github.com/mvdan/sh/syntax"
 )
 
-var parser *syntax.Parser
-
 func main() {
 	flag.Parse()
-	parser = syntax.NewParser()
 
 	for _, path := range flag.Args() {
 		if err := runPath(path); err != nil {
@@ -32,15 +28,10 @@ func runPath(path string) error {
 		return err
 	}
 	defer f.Close()
-	prog, err := parser.Parse(f, path)
-	if err != nil {
-		return err
-	}
 	r := interp.Runner{
-		File:   prog,
 		Stdin:  os.Stdin,
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
 	}
-	return r.Run()
+	return r.RunReader(f, path)
 }
@@ -0,0 +1,22 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import "strings"
+
+// lookupAlias returns the value of an alias if aliases are being
+// expanded, as set via shopt. RunReader's parser uses it to expand
+// aliases as it reads each line.
+func (r *Runner) lookupAlias(name string) (string, bool) {
+	if !r.shopts[optExpandAliases] {
+		return "", false
+	}
+	val, ok := r.aliases[name]
+	return val, ok
+}
+
+// validAliasName reports whether a name can be used for an alias.
+func validAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\n|&;()<>$`\\\"'/=")
+}
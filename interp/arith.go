@@ -4,11 +4,29 @@
 package interp
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/mvdan/sh/syntax"
 )
 
+// parseArithm parses an arithmetic expression given as a string, such
+// as the index in "unset a[i+1]".
+func parseArithm(src string) (syntax.ArithmExpr, error) {
+	p := syntax.NewParser()
+	file, err := p.Parse(strings.NewReader("(("+src+"))"), "")
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Stmts) == 1 {
+		if cmd, ok := file.Stmts[0].Cmd.(*syntax.ArithmCmd); ok && cmd.X != nil {
+			return cmd.X, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid arithmetic expression: %q", src)
+}
+
 func (r *Runner) arithm(expr syntax.ArithmExpr) int {
 	switch x := expr.(type) {
 	case *syntax.Word:
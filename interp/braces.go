@@ -0,0 +1,138 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mvdan/sh/syntax"
+)
+
+// expandBraces performs brace expansion on a word, such as turning
+// "a{b,c}" into "ab" and "ac". It returns the word as-is if it has no
+// brace expressions, or if the shell variant doesn't support them.
+func (r *Runner) expandBraces(word *syntax.Word) []*syntax.Word {
+	if r.Variant == syntax.LangPOSIX {
+		return []*syntax.Word{word}
+	}
+	split, any := syntax.SplitBraces(word)
+	if !any {
+		return []*syntax.Word{word}
+	}
+	return braceWords(split.Parts)
+}
+
+func braceWords(parts []syntax.WordPart) []*syntax.Word {
+	for i, wp := range parts {
+		br, ok := wp.(*syntax.BraceExp)
+		if !ok {
+			continue
+		}
+		var words []*syntax.Word
+		for _, elem := range braceElems(br) {
+			var parts2 []syntax.WordPart
+			parts2 = append(parts2, parts[:i]...)
+			parts2 = append(parts2, elem.Parts...)
+			parts2 = append(parts2, parts[i+1:]...)
+			// the element and the rest of the word may
+			// contain more brace expressions
+			words = append(words, braceWords(parts2)...)
+		}
+		return words
+	}
+	return []*syntax.Word{{Parts: parts}}
+}
+
+// braceElems returns the words that a brace expression expands to,
+// generating them if it is a sequence like {1..10..2} or {a..e}.
+func braceElems(br *syntax.BraceExp) []*syntax.Word {
+	if !br.Sequence {
+		return br.Elems
+	}
+	// SplitBraces already checked that these are valid
+	var vals [3]string
+	for i, elem := range br.Elems {
+		vals[i] = elem.Parts[0].(*syntax.Lit).Value
+	}
+	incr := 1
+	if vals[2] != "" {
+		incr = atoi(vals[2])
+	}
+	if incr < 0 {
+		incr = -incr
+	} else if incr == 0 {
+		incr = 1
+	}
+	var strs []string
+	start, err1 := strconv.Atoi(vals[0])
+	end, err2 := strconv.Atoi(vals[1])
+	if err1 == nil && err2 == nil {
+		// {01..10} pads all numbers to the same width
+		width := 0
+		if zeroPadded(vals[0]) || zeroPadded(vals[1]) {
+			width = len(vals[0])
+			if len(vals[1]) > width {
+				width = len(vals[1])
+			}
+		}
+		for _, n := range seqInts(start, end, incr) {
+			str := strconv.Itoa(n)
+			if width > 0 {
+				str = padInt(n, width)
+			}
+			strs = append(strs, str)
+		}
+	} else {
+		for _, n := range seqInts(int(vals[0][0]), int(vals[1][0]), incr) {
+			strs = append(strs, string(rune(n)))
+		}
+	}
+	words := make([]*syntax.Word, len(strs))
+	for i, str := range strs {
+		words[i] = &syntax.Word{Parts: []syntax.WordPart{&syntax.Lit{
+			ValuePos: br.Lbrace,
+			ValueEnd: br.Rbrace + 1,
+			Value:    str,
+		}}}
+	}
+	return words
+}
+
+// seqInts returns the integers from start to end, both included, going
+// in steps of incr in whichever direction is necessary. The loop stops
+// before a step would go past end, so that it never overflows.
+func seqInts(start, end, incr int) []int {
+	// the distances are unsigned, as they may not fit in an int
+	step := uint64(incr)
+	ns := []int{start}
+	if start <= end {
+		for n := start; uint64(end)-uint64(n) >= step; {
+			n += incr
+			ns = append(ns, n)
+		}
+	} else {
+		for n := start; uint64(n)-uint64(end) >= step; {
+			n -= incr
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
+
+func zeroPadded(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+func padInt(n, width int) string {
+	if n < 0 {
+		return "-" + padInt(-n, width-1)
+	}
+	str := strconv.Itoa(n)
+	if len(str) < width {
+		str = strings.Repeat("0", width-len(str)) + str
+	}
+	return str
+}
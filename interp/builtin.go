@@ -4,9 +4,7 @@
 package interp
 
 import (
-	"os"
-	"os/exec"
-	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -18,13 +16,39 @@ func isBuiltin(name string) bool {
 	case "true", ":", "false", "exit", "set", "shift", "unset",
 		"echo", "printf", "break", "continue", "pwd", "cd",
 		"wait", "builtin", "trap", "type", "source", "command",
-		"pushd", "popd", "umask", "alias", "unalias", "fg", "bg",
-		"getopts", "eval", "test", "[":
+		"pushd", "popd", "dirs", "umask", "alias", "unalias", "fg", "bg",
+		"getopts", "eval", "test", "[", "shopt", "hash":
 		return true
 	}
 	return false
 }
 
+// isBuiltin is like the package-level isBuiltin, but also including
+// the extra builtins in the Builtins field.
+func (r *Runner) isBuiltin(name string) bool {
+	return r.Builtins[name] != nil || isBuiltin(name)
+}
+
+// Shell options that can be set via the shopt builtin.
+const (
+	optExpandAliases = iota
+	optXpgEcho
+)
+
+var shoptNames = [...]string{
+	optExpandAliases: "expand_aliases",
+	optXpgEcho:       "xpg_echo",
+}
+
+func shoptIndex(name string) int {
+	for i, opt := range shoptNames {
+		if opt == name {
+			return i
+		}
+	}
+	return -1
+}
+
 func (r *Runner) builtinCode(pos syntax.Pos, name string, args []string) int {
 	switch name {
 	case "true", ":":
@@ -45,6 +69,9 @@ func (r *Runner) builtinCode(pos syntax.Pos, name string, args []string) int {
 		r.lastExit()
 		return r.exit
 	case "set":
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
 		r.args = args
 	case "shift":
 		n := 1
@@ -66,28 +93,50 @@ func (r *Runner) builtinCode(pos syntax.Pos, name string, args []string) int {
 		r.args = r.args[n:]
 	case "unset":
 		for _, arg := range args {
+			if i := strings.IndexByte(arg, '['); i > 0 && arg[len(arg)-1] == ']' {
+				r.delVarElem(arg[:i], arg[i+1:len(arg)-1])
+				continue
+			}
 			r.delVar(arg)
 		}
 	case "echo":
 		newline := true
+		// POSIX echo always interprets escape sequences
+		expand := r.shopts[optXpgEcho] || r.Variant == syntax.LangPOSIX
 	opts:
 		for len(args) > 0 {
-			switch args[0] {
-			case "-n":
-				newline = false
-			case "-e", "-E":
-				// TODO: what should be our default?
-				// exactly what is the difference in
-				// what we write?
-			default:
+			flags := args[0]
+			if len(flags) < 2 || flags[0] != '-' {
+				break opts
+			}
+			if strings.Trim(flags[1:], "neE") != "" {
+				// not an option, like "-x" or "--"
 				break opts
 			}
+			for _, c := range flags[1:] {
+				switch c {
+				case 'n':
+					newline = false
+				case 'e':
+					expand = true
+				case 'E':
+					expand = false
+				}
+			}
 			args = args[1:]
 		}
 		for i, arg := range args {
 			if i > 0 {
 				r.outf(" ")
 			}
+			if expand {
+				var stop bool
+				if arg, stop = echoEscapes(arg); stop {
+					// \c stops all output
+					r.outf("%s", arg)
+					return 0
+				}
+			}
 			r.outf("%s", arg)
 		}
 		if newline {
@@ -142,24 +191,13 @@ func (r *Runner) builtinCode(pos syntax.Pos, name string, args []string) int {
 	case "pwd":
 		r.outf("%s\n", r.getVar("PWD"))
 	case "cd":
-		if len(args) > 1 {
-			r.errf("usage: cd [dir]\n")
-			return 2
-		}
-		var dir string
-		if len(args) == 0 {
-			dir = r.getVar("HOME")
-		} else {
-			dir = args[0]
-		}
-		if !filepath.IsAbs(dir) {
-			dir = filepath.Join(r.Dir, dir)
-		}
-		_, err := os.Stat(dir)
-		if err != nil {
-			return 1
-		}
-		r.Dir = dir
+		return r.cd(args)
+	case "pushd":
+		return r.pushd(args)
+	case "popd":
+		return r.popd(args)
+	case "dirs":
+		return r.dirs(args)
 	case "wait":
 		if len(args) > 0 {
 			r.runErr(pos, "wait with args not handled yet")
@@ -170,31 +208,206 @@ func (r *Runner) builtinCode(pos syntax.Pos, name string, args []string) int {
 		if len(args) < 1 {
 			break
 		}
+		if fn := r.Builtins[args[0]]; fn != nil {
+			return r.callBuiltinFunc(fn, args[1:])
+		}
 		if !isBuiltin(args[0]) {
 			return 1
 		}
 		return r.builtinCode(pos, args[0], args[1:])
 	case "type":
+		var all, noFuncs, onlyPath, forcePath, onlyKind bool
+		for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+			for _, c := range args[0][1:] {
+				switch c {
+				case 'a':
+					all = true
+				case 'f':
+					noFuncs = true
+				case 'p':
+					onlyPath = true
+				case 'P':
+					forcePath = true
+				case 't':
+					onlyKind = true
+				default:
+					r.errf("usage: type [-afptP] name [name ...]\n")
+					return 2
+				}
+			}
+			args = args[1:]
+		}
 		anyNotFound := false
 		for _, arg := range args {
-			if _, ok := r.funcs[arg]; ok {
-				r.outf("%s is a function\n", arg)
-				continue
+			var kinds []cmdKind
+			if forcePath {
+				for _, path := range r.findExecutables(arg, r.pathList(), all) {
+					kinds = append(kinds, cmdKind{kind: "file", value: path})
+				}
+			} else {
+				for _, k := range r.cmdKinds(arg, r.pathList(), all) {
+					if !noFuncs || k.kind != "function" {
+						kinds = append(kinds, k)
+					}
+				}
 			}
-			if isBuiltin(arg) {
-				r.outf("%s is a shell builtin\n", arg)
+			if len(kinds) == 0 {
+				if !onlyKind && !onlyPath && !forcePath {
+					r.errf("type: %s: not found\n", arg)
+				}
+				anyNotFound = true
 				continue
 			}
-			if path, err := exec.LookPath(arg); err == nil {
-				r.outf("%s is %s\n", arg, path)
-				continue
+			for _, k := range kinds {
+				switch {
+				case onlyKind:
+					r.outf("%s\n", k.kind)
+				case onlyPath, forcePath:
+					if k.kind == "file" {
+						r.outf("%s\n", k.value)
+					}
+				default:
+					r.outf("%s\n", describe(arg, k))
+				}
 			}
-			r.errf("type: %s: not found\n", arg)
-			anyNotFound = true
 		}
 		if anyNotFound {
 			return 1
 		}
+	case "command":
+		var stdPath, show, verbose bool
+		for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+			if args[0] == "--" {
+				args = args[1:]
+				break
+			}
+			for _, c := range args[0][1:] {
+				switch c {
+				case 'p':
+					stdPath = true
+				case 'v':
+					show = true
+				case 'V':
+					show, verbose = true, true
+				default:
+					r.errf("usage: command [-pVv] command [arg ...]\n")
+					return 2
+				}
+			}
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			break
+		}
+		if !show {
+			r.callNoFuncs(pos, args[0], args[1:], stdPath)
+			return r.exit
+		}
+		pathList := r.pathList()
+		if stdPath {
+			pathList = defaultPath
+		}
+		status := 0
+		for _, arg := range args {
+			kinds := r.cmdKinds(arg, pathList, false)
+			switch {
+			case len(kinds) == 0:
+				if verbose {
+					r.errf("command: %s: not found\n", arg)
+				}
+				status = 1
+			case verbose:
+				r.outf("%s\n", describe(arg, kinds[0]))
+			case kinds[0].kind == "alias":
+				r.outf("alias %s=%s\n", arg, shellQuote(kinds[0].value))
+			case kinds[0].kind == "file":
+				r.outf("%s\n", kinds[0].value)
+			default:
+				r.outf("%s\n", arg)
+			}
+		}
+		return status
+	case "hash":
+		var reset, remove, list, show bool
+		for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+			flag := args[0]
+			args = args[1:]
+			switch flag {
+			case "-r":
+				reset = true
+			case "-d":
+				remove = true
+			case "-l":
+				list = true
+			case "-t":
+				show = true
+			case "-p":
+				if len(args) < 2 {
+					r.errf("hash: -p: option requires an argument\n")
+					return 2
+				}
+				r.hashes.add(args[1], args[0], 0)
+				return 0
+			default:
+				r.errf("usage: hash [-lr] [-p pathname] [-dt] [name ...]\n")
+				return 2
+			}
+		}
+		if reset {
+			r.hashes.reset()
+		}
+		status := 0
+		for _, arg := range args {
+			switch {
+			case remove:
+				if !r.hashes.remove(arg) {
+					r.errf("hash: %s: not found\n", arg)
+					status = 1
+				}
+			case show:
+				path, ok := r.hashes.lookup(arg)
+				switch {
+				case !ok:
+					r.errf("hash: %s: not found\n", arg)
+					status = 1
+				case len(args) > 1:
+					r.outf("%s\t%s\n", arg, path)
+				default:
+					r.outf("%s\n", path)
+				}
+			default:
+				if _, ok := r.funcs[arg]; ok || r.isBuiltin(arg) {
+					continue
+				}
+				paths := r.findExecutables(arg, r.pathList(), false)
+				if len(paths) == 0 || strings.Contains(arg, "/") {
+					r.errf("hash: %s: not found\n", arg)
+					status = 1
+					continue
+				}
+				r.hashes.add(arg, paths[0], 0)
+			}
+		}
+		if len(args) > 0 || reset {
+			return status
+		}
+		names, entries := r.hashes.list()
+		if len(names) == 0 {
+			if !list {
+				r.outf("hash: hash table empty\n")
+			}
+			break
+		}
+		if !list {
+			r.outf("hits\tcommand\n")
+		}
+		for i, name := range names {
+			if list {
+				r.outf("builtin hash -p %s %s\n", entries[i].path, name)
+			} else {
+				r.outf("%4d\t%s\n", entries[i].hits, entries[i].path)
+			}
+		}
 	case "eval":
 		src := strings.Join(args, " ")
 		p := syntax.NewParser()
@@ -224,9 +437,254 @@ func (r *Runner) builtinCode(pos syntax.Pos, name string, args []string) int {
 		p.next()
 		expr := p.classicTest("[", false)
 		return oneIf(r.bashTest(expr) == "")
-	case "trap", "source", "command", "pushd", "popd",
-		"umask", "alias", "unalias", "fg", "bg", "getopts":
+	case "shopt":
+		mode := ""
+		print := false
+		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+			switch args[0] {
+			case "-s", "-u":
+				mode = args[0]
+			case "-p":
+				print = true
+			default:
+				r.errf("usage: shopt [-psu] [optname...]\n")
+				return 2
+			}
+			args = args[1:]
+		}
+		listAll := len(args) == 0
+		if listAll {
+			for _, name := range shoptNames {
+				args = append(args, name)
+			}
+		}
+		status := 0
+		for _, arg := range args {
+			i := shoptIndex(arg)
+			if i < 0 {
+				r.errf("shopt: %s: invalid shell option name\n", arg)
+				status = 1
+				continue
+			}
+			switch mode {
+			case "-s":
+				r.shopts[i] = true
+			case "-u":
+				r.shopts[i] = false
+			default:
+				switch {
+				case print && r.shopts[i]:
+					r.outf("shopt -s %s\n", arg)
+				case print:
+					r.outf("shopt -u %s\n", arg)
+				case r.shopts[i]:
+					r.outf("%-15s\ton\n", arg)
+				default:
+					r.outf("%-15s\toff\n", arg)
+				}
+				if !r.shopts[i] && !listAll {
+					status = 1
+				}
+			}
+		}
+		return status
+	case "getopts":
+		if len(args) < 2 {
+			r.errf("getopts: usage: getopts optstring name [arg ...]\n")
+			return 2
+		}
+		optstr, name := args[0], args[1]
+		args = args[2:]
+		if len(args) == 0 {
+			args = r.args
+		}
+		optind, _ := strconv.Atoi(r.getVar("OPTIND"))
+		if optind < 1 {
+			optind = 1
+		}
+		if optind-1 != r.optState.argidx {
+			r.optState = getopts{argidx: optind - 1}
+		}
+		silent := strings.HasPrefix(optstr, ":")
+		if silent {
+			optstr = optstr[1:]
+		}
+		opt, optarg, done := r.optState.next(optstr, args)
+		state := r.optState
+		r.setVar("OPTIND", strconv.Itoa(state.argidx+1))
+		r.optState = state
+		r.delVar("OPTARG")
+		switch {
+		case done:
+			r.setVar(name, "?")
+			return 1
+		case opt == '?' && silent:
+			r.setVar(name, "?")
+			r.setVar("OPTARG", optarg)
+		case opt == '?':
+			r.setVar(name, "?")
+			if r.getVar("OPTERR") != "0" {
+				r.errf("%s: illegal option -- %s\n", r.shellName(), optarg)
+			}
+		case opt == ':' && silent:
+			r.setVar(name, ":")
+			r.setVar("OPTARG", optarg)
+		case opt == ':':
+			r.setVar(name, "?")
+			if r.getVar("OPTERR") != "0" {
+				r.errf("%s: option requires an argument -- %s\n", r.shellName(), optarg)
+			}
+		default:
+			r.setVar(name, string(opt))
+			if strings.Contains(optstr, string(opt)+":") {
+				r.setVar("OPTARG", optarg)
+			}
+		}
+	case "alias":
+		if len(args) > 0 && args[0] == "-p" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			names := make([]string, 0, len(r.aliases))
+			for name := range r.aliases {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				r.outf("alias %s=%s\n", name, shellQuote(r.aliases[name]))
+			}
+			break
+		}
+		status := 0
+		for _, arg := range args {
+			i := strings.IndexByte(arg, '=')
+			if i < 0 {
+				if val, ok := r.aliases[arg]; ok {
+					r.outf("alias %s=%s\n", arg, shellQuote(val))
+				} else {
+					r.errf("alias: %s: not found\n", arg)
+					status = 1
+				}
+				continue
+			}
+			name, val := arg[:i], arg[i+1:]
+			if !validAliasName(name) {
+				r.errf("alias: %s: invalid alias name\n", name)
+				status = 1
+				continue
+			}
+			if r.aliases == nil {
+				r.aliases = make(map[string]string, 4)
+			}
+			r.aliases[name] = val
+		}
+		return status
+	case "unalias":
+		if len(args) > 0 && args[0] == "-a" {
+			r.aliases = nil
+			break
+		}
+		if len(args) == 0 {
+			r.errf("unalias: usage: unalias [-a] name [name ...]\n")
+			return 2
+		}
+		status := 0
+		for _, name := range args {
+			if _, ok := r.aliases[name]; !ok {
+				r.errf("unalias: %s: not found\n", name)
+				status = 1
+				continue
+			}
+			delete(r.aliases, name)
+		}
+		return status
+	case "umask":
+		symbolic, print := false, false
+		for len(args) > 0 && (args[0] == "-S" || args[0] == "-p") {
+			if args[0] == "-S" {
+				symbolic = true
+			} else {
+				print = true
+			}
+			args = args[1:]
+		}
+		if len(args) > 0 {
+			mask, err := parseUmask(args[0], r.umask)
+			if err != nil {
+				r.errf("umask: %v\n", err)
+				return 1
+			}
+			r.umask = mask
+			break
+		}
+		if print {
+			r.outf("umask ")
+			if symbolic {
+				r.outf("-S ")
+			}
+		}
+		if symbolic {
+			r.outf("%s\n", symbolicUmask(r.umask))
+		} else {
+			r.outf("%04o\n", uint32(r.umask))
+		}
+	case "trap", "source", "fg", "bg":
 		r.runErr(pos, "unhandled builtin: %s", name)
 	}
 	return 0
 }
+
+// getopts holds the state of the getopts builtin between calls, since
+// grouped options like "-ab" are parsed one at a time.
+type getopts struct {
+	argidx  int // index of the argument being parsed, OPTIND-1
+	runeidx int // index of the next option within that argument
+}
+
+// next parses the next option in args following optstr. The returned
+// option is '?' for an unknown option and ':' for a missing argument,
+// in which case optarg holds the offending option character. done
+// reports that there are no options left.
+func (g *getopts) next(optstr string, args []string) (opt rune, optarg string, done bool) {
+	if g.argidx >= len(args) {
+		return '?', "", true
+	}
+	arg := []rune(args[g.argidx])
+	if len(arg) < 2 || arg[0] != '-' {
+		return '?', "", true
+	}
+	if string(arg) == "--" {
+		g.argidx++
+		return '?', "", true
+	}
+	opts := arg[1:]
+	if g.runeidx >= len(opts) {
+		g.runeidx = 0
+	}
+	opt = opts[g.runeidx]
+	g.runeidx++
+	rest := string(opts[g.runeidx:])
+	if rest == "" {
+		g.argidx++
+		g.runeidx = 0
+	}
+	i := strings.IndexRune(optstr, opt)
+	if opt == ':' || i < 0 {
+		return '?', string(opt), false
+	}
+	if !strings.HasPrefix(optstr[i+len(string(opt)):], ":") {
+		return opt, "", false
+	}
+	if rest != "" {
+		// the argument is attached, like "-fvalue"
+		g.argidx++
+		g.runeidx = 0
+		return opt, rest, false
+	}
+	if g.argidx >= len(args) {
+		return ':', string(opt), false
+	}
+	optarg = args[g.argidx]
+	g.argidx++
+	return opt, optarg, false
+}
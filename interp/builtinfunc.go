@@ -0,0 +1,69 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"context"
+	"io"
+)
+
+// A BuiltinFunc is a builtin implemented in Go, which can be added to
+// a Runner via its Builtins field. It is given the arguments that
+// follow the builtin's name, and it returns the exit status.
+type BuiltinFunc func(bc *BuiltinContext, args []string) int
+
+// BuiltinContext gives a BuiltinFunc access to the state of the Runner
+// that is calling it. It is only valid during the call.
+type BuiltinContext struct {
+	// Context is the Runner's context, which is cancelled if the
+	// interpreter is stopped.
+	Context context.Context
+
+	// Dir is the current directory of the interpreter.
+	Dir string
+
+	// Stdin, Stdout and Stderr are the streams of the call,
+	// including any of its redirections.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	r *Runner
+}
+
+// LookupEnv returns the value of a shell variable, and whether it is
+// set. Arrays are returned like $name, i.e. their first element.
+func (bc *BuiltinContext) LookupEnv(name string) (string, bool) {
+	val, ok := bc.r.lookupVar(name)
+	return varStr(val), ok
+}
+
+// Getenv is like LookupEnv, but returns the empty string if the
+// variable is not set.
+func (bc *BuiltinContext) Getenv(name string) string {
+	val, _ := bc.LookupEnv(name)
+	return val
+}
+
+// Setenv sets a shell variable, like an assignment would.
+func (bc *BuiltinContext) Setenv(name, value string) {
+	bc.r.setVar(name, value)
+}
+
+// Unsetenv unsets a shell variable, like the unset builtin would.
+func (bc *BuiltinContext) Unsetenv(name string) {
+	bc.r.delVar(name)
+}
+
+func (r *Runner) callBuiltinFunc(fn BuiltinFunc, args []string) int {
+	bc := &BuiltinContext{
+		Context: r.Context,
+		Dir:     r.Dir,
+		Stdin:   r.Stdin,
+		Stdout:  r.Stdout,
+		Stderr:  r.Stderr,
+		r:       r,
+	}
+	return fn(bc, args)
+}
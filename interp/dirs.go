@@ -0,0 +1,350 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cd implements the cd builtin.
+func (r *Runner) cd(args []string) int {
+	physical := false
+opts:
+	for len(args) > 0 {
+		switch args[0] {
+		case "-L":
+			physical = false
+		case "-P":
+			physical = true
+		case "--":
+			args = args[1:]
+			break opts
+		default:
+			break opts
+		}
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		r.errf("usage: cd [-L|-P] [dir]\n")
+		return 2
+	}
+	var dir string
+	print := false
+	switch {
+	case len(args) == 0:
+		dir = r.getVar("HOME")
+		if dir == "" {
+			r.errf("cd: HOME not set\n")
+			return 1
+		}
+	case args[0] == "-":
+		dir = r.getVar("OLDPWD")
+		if dir == "" {
+			r.errf("cd: OLDPWD not set\n")
+			return 1
+		}
+		print = true
+	case args[0] == "":
+		return 0
+	default:
+		dir = args[0]
+		if found := r.searchCdpath(dir); found != "" {
+			dir = found
+			print = true
+		}
+	}
+	if code := r.changeDir("cd", dir, physical); code != 0 {
+		return code
+	}
+	if print {
+		r.outf("%s\n", r.Dir)
+	}
+	return 0
+}
+
+// searchCdpath looks for a relative directory in each of the entries
+// in CDPATH, returning the first one that exists. Empty entries stand
+// for the current directory and are not returned, as they would not
+// change the result.
+func (r *Runner) searchCdpath(dir string) string {
+	cdpath := r.getVar("CDPATH")
+	if cdpath == "" || filepath.IsAbs(dir) {
+		return ""
+	}
+	first := dir
+	if i := strings.IndexByte(dir, '/'); i >= 0 {
+		first = dir[:i]
+	}
+	if first == "." || first == ".." {
+		return ""
+	}
+	for _, entry := range filepath.SplitList(cdpath) {
+		if entry == "" {
+			if dirError(r.absPath(dir)) == "" {
+				return ""
+			}
+			continue
+		}
+		path := r.absPath(filepath.Join(entry, dir))
+		if dirError(path) == "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// absPath makes a path absolute by joining it to the current directory
+// if needed. As with cd -L, ".." elements are resolved logically.
+func (r *Runner) absPath(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Dir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// changeDir changes the current directory, keeping OLDPWD up to date.
+// If physical is true, symbolic links are resolved like in cd -P. On
+// failure, an error is printed with the builtin's name and the exit
+// status is returned.
+func (r *Runner) changeDir(builtin, dir string, physical bool) int {
+	path := r.absPath(dir)
+	if msg := dirError(path); msg != "" {
+		r.errf("%s: %s: %s\n", builtin, dir, msg)
+		return 1
+	}
+	if physical {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			path = real
+		}
+	}
+	r.setVar("OLDPWD", r.Dir)
+	r.Dir = path
+	return 0
+}
+
+// dirError returns why a path cannot be used as the current directory,
+// in the words that shells use. It returns the empty string if it can
+// be used.
+func dirError(path string) string {
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		return "No such file or directory"
+	case os.IsPermission(err):
+		return "Permission denied"
+	case err != nil:
+		if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.ENOTDIR {
+			return "Not a directory"
+		}
+		return err.Error()
+	case !info.IsDir():
+		return "Not a directory"
+	}
+	// the directory itself must be searchable too
+	if _, err := os.Stat(path + string(filepath.Separator) + "."); os.IsPermission(err) {
+		return "Permission denied"
+	}
+	return ""
+}
+
+// stackIndex parses a directory stack argument like "+N" or "-N",
+// returning the index into the stack including the current directory.
+func (r *Runner) stackIndex(arg string) (int, bool) {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return 0, false
+	}
+	n, err := strconv.Atoi(arg[1:])
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	size := len(r.dirStack) + 1
+	if arg[0] == '-' {
+		n = size - 1 - n
+	}
+	if n < 0 || n >= size {
+		return -1, true
+	}
+	return n, true
+}
+
+// tildeShort replaces a leading $HOME with a tilde, like the dirs
+// builtin does.
+func (r *Runner) tildeShort(dir string) string {
+	home := r.getVar("HOME")
+	switch {
+	case home == "" || home == "/":
+	case dir == home:
+		return "~"
+	case strings.HasPrefix(dir, home+"/"):
+		return "~" + dir[len(home):]
+	}
+	return dir
+}
+
+// pushd implements the pushd builtin.
+func (r *Runner) pushd(args []string) int {
+	noChange := false
+	if len(args) > 0 && args[0] == "-n" {
+		noChange = true
+		args = args[1:]
+	}
+	dirs := append([]string{r.Dir}, r.dirStack...)
+	switch {
+	case len(args) > 1:
+		r.errf("usage: pushd [-n] [+N | -N | dir]\n")
+		return 2
+	case len(args) == 0:
+		if len(r.dirStack) == 0 {
+			r.errf("pushd: no other directory\n")
+			return 1
+		}
+		dirs[0], dirs[1] = dirs[1], dirs[0]
+	default:
+		n, ok := r.stackIndex(args[0])
+		if !ok {
+			if noChange {
+				r.dirStack = append([]string{r.absPath(args[0])}, r.dirStack...)
+				r.dirs(nil)
+				return 0
+			}
+			old := r.Dir
+			if code := r.changeDir("pushd", args[0], false); code != 0 {
+				return code
+			}
+			r.dirStack = append([]string{old}, r.dirStack...)
+			r.dirs(nil)
+			return 0
+		}
+		if len(r.dirStack) == 0 {
+			r.errf("pushd: directory stack empty\n")
+			return 1
+		}
+		if n < 0 {
+			r.errf("pushd: %s: directory stack index out of range\n", args[0])
+			return 1
+		}
+		// rotate the stack so that the nth directory is on top
+		dirs = append(dirs[n:], dirs[:n]...)
+	}
+	if !noChange && dirs[0] != r.Dir {
+		if code := r.changeDir("pushd", dirs[0], false); code != 0 {
+			return code
+		}
+	}
+	r.dirStack = dirs[1:]
+	r.dirs(nil)
+	return 0
+}
+
+// popd implements the popd builtin.
+func (r *Runner) popd(args []string) int {
+	noChange := false
+	if len(args) > 0 && args[0] == "-n" {
+		noChange = true
+		args = args[1:]
+	}
+	n := 0
+	switch {
+	case len(args) > 1:
+		r.errf("usage: popd [-n] [+N | -N]\n")
+		return 2
+	case len(args) == 1:
+		var ok bool
+		if n, ok = r.stackIndex(args[0]); !ok {
+			r.errf("popd: %s: invalid argument\n", args[0])
+			return 2
+		}
+	}
+	if len(r.dirStack) == 0 {
+		r.errf("popd: directory stack empty\n")
+		return 1
+	}
+	if n < 0 {
+		r.errf("popd: %s: directory stack index out of range\n", args[0])
+		return 1
+	}
+	if n > 0 {
+		r.dirStack = append(r.dirStack[:n-1:n-1], r.dirStack[n:]...)
+	} else if noChange {
+		r.dirStack = r.dirStack[1:]
+	} else {
+		if code := r.changeDir("popd", r.dirStack[0], false); code != 0 {
+			return code
+		}
+		r.dirStack = r.dirStack[1:]
+	}
+	r.dirs(nil)
+	return 0
+}
+
+// dirs implements the dirs builtin.
+func (r *Runner) dirs(args []string) int {
+	long, verbose, lines := false, false, false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		if _, ok := r.stackIndex(args[0]); ok {
+			break
+		}
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'c':
+				r.dirStack = nil
+				return 0
+			case 'l':
+				long = true
+			case 'v':
+				verbose = true
+			case 'p':
+				lines = true
+			default:
+				r.errf("usage: dirs [-clpv] [+N] [-N]\n")
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+	dirs := append([]string{r.Dir}, r.dirStack...)
+	if !long {
+		for i, dir := range dirs {
+			dirs[i] = r.tildeShort(dir)
+		}
+	}
+	if len(args) > 0 {
+		n, ok := r.stackIndex(args[0])
+		if !ok {
+			r.errf("usage: dirs [-clpv] [+N] [-N]\n")
+			return 2
+		}
+		if n < 0 {
+			r.errf("dirs: %s: directory stack index out of range\n", args[0])
+			return 1
+		}
+		if verbose {
+			r.outf("%2d  %s\n", n, dirs[n])
+		} else {
+			r.outf("%s\n", dirs[n])
+		}
+		return 0
+	}
+	for i, dir := range dirs {
+		switch {
+		case verbose:
+			r.outf("%2d  %s\n", i, dir)
+		case lines:
+			r.outf("%s\n", dir)
+		default:
+			if i > 0 {
+				r.outf(" ")
+			}
+			r.outf("%s", dir)
+		}
+	}
+	if !verbose && !lines {
+		r.outf("\n")
+	}
+	return 0
+}
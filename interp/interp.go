@@ -6,16 +6,19 @@ package interp
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/user"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/mvdan/sh/syntax"
 )
@@ -23,6 +26,11 @@ import (
 // A Runner interprets shell programs. It cannot be reused once a
 // program has been interpreted.
 //
+// Programs are started with the process umask temporarily set to the
+// runner's, as set via the umask builtin, since that is the only way
+// for them to inherit it. Files created by other goroutines while a
+// program is starting may be affected.
+//
 // Note that writes to Stdout and Stderr may not be sequential. If
 // you plan on using an io.Writer implementation that isn't safe for
 // concurrent use, consider a workaround like hiding writes behind a
@@ -43,6 +51,12 @@ type Runner struct {
 	// process's current directory.
 	Dir string
 
+	// Variant is the shell language variant to follow, which should
+	// match the one used to parse File. For example, LangPOSIX
+	// leaves brace expressions like {a,b} as literals. The default
+	// is LangBash.
+	Variant syntax.LangVariant
+
 	// Separate maps, note that bash allows a name to be both a var
 	// and a func simultaneously
 	vars  map[string]varValue
@@ -54,11 +68,34 @@ type Runner struct {
 	// Current arguments, if executing a function
 	args []string
 
+	// aliases defined via the alias builtin
+	aliases map[string]string
+
+	// remembered paths to programs, as listed by the hash builtin
+	hashes *hashTable
+
+	// state of the getopts builtin, to parse grouped options
+	optState getopts
+
+	// whether command_not_found_handle is being run
+	inNotFound bool
+
+	// Directory stack, excluding the current directory and with the
+	// most recent directory first
+	dirStack []string
+
 	// >0 to break or continue out of N enclosing loops
 	breakEnclosing, contnEnclosing int
 
 	inLoop bool
 
+	// file mode creation mask, as set via umask
+	umask    os.FileMode
+	umaskSet bool
+
+	// shell options, as set via shopt
+	shopts [len(shoptNames)]bool
+
 	err  error // current fatal error
 	exit int   // current (last) exit code
 
@@ -70,21 +107,94 @@ type Runner struct {
 
 	// Context can be used to cancel the interpreter before it finishes
 	Context context.Context
+
+	// Translate, if non-nil, is used to translate the strings within
+	// $"..." quotes, like bash does via gettext. It is given the
+	// value of TEXTDOMAIN and the source text between the quotes,
+	// and it should return the translated text, which is then
+	// expanded as if it were within double quotes. If Translate is
+	// nil, $"..." strings are treated like "..." strings.
+	Translate func(domain, msg string) string
+
+	// ProcessGroups makes each program start in its own process
+	// group, so that when the context is cancelled, the signals
+	// reach its descendants too. This is not supported on all
+	// systems.
+	ProcessGroups bool
+
+	// KillTimeout is how long to wait after sending SIGTERM to a
+	// program when the context is cancelled, before sending SIGKILL.
+	// If zero, a default of two seconds is used. If negative, SIGKILL
+	// is never sent.
+	KillTimeout time.Duration
+
+	// Builtins holds extra builtins implemented in Go, by name. They
+	// take precedence over the shell's own builtins and over programs
+	// found via PATH, but not over functions.
+	Builtins map[string]BuiltinFunc
 }
 
-// varValue can hold a string, an indexed array ([]string) or an
-// associative array (map[string]string)
-// TODO: implement associative arrays
+// varValue can hold a string, an indexed array (indexArray) or an
+// associative array (assocArray)
 type varValue interface{}
 
+// indexArray is an indexed array. It is a map since bash arrays may
+// be sparse, e.g. after "a[5]=x" or "unset a[1]".
+type indexArray map[int]string
+
+// keys returns the indices that are set, in increasing order.
+func (a indexArray) keys() []int {
+	keys := make([]int, 0, len(a))
+	for i := range a {
+		keys = append(keys, i)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// values returns the elements ordered by their indices.
+func (a indexArray) values() []string {
+	vals := make([]string, 0, len(a))
+	for _, i := range a.keys() {
+		vals = append(vals, a[i])
+	}
+	return vals
+}
+
+// next returns the index after the highest one that is set, which is
+// where appended elements go and what negative indices are relative to.
+func (a indexArray) next() int {
+	n := 0
+	for i := range a {
+		if i >= n {
+			n = i + 1
+		}
+	}
+	return n
+}
+
+// assocArray is an associative array, declared via "declare -A".
+type assocArray map[string]string
+
+// keys returns the keys that are set. They are sorted so that
+// expansions like ${!a[@]} are deterministic.
+func (a assocArray) keys() []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func varStr(v varValue) string {
 	switch x := v.(type) {
 	case string:
 		return x
-	case []string:
-		if len(x) > 0 {
-			return x[0]
-		}
+	case indexArray:
+		return x[0]
+	case assocArray:
+		return x["0"]
 	}
 	return ""
 }
@@ -96,24 +206,30 @@ func (r *Runner) varInd(v varValue, e syntax.ArithmExpr) string {
 		if i == 0 {
 			return x
 		}
-	case []string:
-		// TODO: @ between double quotes
-		if w, ok := e.(*syntax.Word); ok {
-			if lit, ok := w.Parts[0].(*syntax.Lit); ok {
-				switch lit.Value {
-				case "@", "*":
-					return strings.Join(x, " ")
-				}
-			}
-		}
+	case indexArray:
 		i := r.arithm(e)
-		if len(x) > 0 {
-			return x[i]
+		if i < 0 {
+			i += x.next()
 		}
+		return x[i]
+	case assocArray:
+		return x[r.assocKey(e, nil)]
 	}
 	return ""
 }
 
+// assocKey returns the key that an index refers to in an associative
+// array, such as in ${a[key]} or a["key"]=value.
+func (r *Runner) assocKey(index syntax.ArithmExpr, key *syntax.DblQuoted) string {
+	if key != nil {
+		return r.loneWord(&syntax.Word{Parts: []syntax.WordPart{key}})
+	}
+	if w, ok := index.(*syntax.Word); ok {
+		return r.loneWord(w)
+	}
+	return strconv.Itoa(r.arithm(index))
+}
+
 type ExitCode uint8
 
 func (e ExitCode) Error() string { return fmt.Sprintf("exit status %d", e) }
@@ -146,6 +262,14 @@ func (r *Runner) setVar(name string, val varValue) {
 	if r.vars == nil {
 		r.vars = make(map[string]varValue, 4)
 	}
+	if name == "PATH" && r.hashes != nil {
+		// the remembered paths may no longer be valid
+		r.hashes.reset()
+	}
+	if name == "OPTIND" {
+		// like in bash, assigning OPTIND resets getopts
+		r.optState = getopts{}
+	}
 	r.vars[name] = val
 }
 
@@ -153,9 +277,6 @@ func (r *Runner) lookupVar(name string) (varValue, bool) {
 	switch name {
 	case "PWD":
 		return r.Dir, true
-	case "HOME":
-		u, _ := user.Current()
-		return u.HomeDir, true
 	}
 	if val, e := r.cmdVars[name]; e {
 		return val, true
@@ -163,8 +284,17 @@ func (r *Runner) lookupVar(name string) (varValue, bool) {
 	if val, e := r.vars[name]; e {
 		return val, true
 	}
-	str, e := r.envMap[name]
-	return str, e
+	if str, e := r.envMap[name]; e {
+		return str, true
+	}
+	if name == "HOME" {
+		// like shells, fall back to the user database if
+		// HOME is not set
+		if u, err := user.Current(); err == nil {
+			return u.HomeDir, true
+		}
+	}
+	return nil, false
 }
 
 func (r *Runner) getVar(name string) string {
@@ -177,6 +307,57 @@ func (r *Runner) delVar(name string) {
 	delete(r.envMap, name)
 }
 
+// delVarElem unsets a single element of an array, such as in
+// "unset a[1]". For indexed arrays, the index is an arithmetic
+// expression.
+func (r *Runner) delVarElem(name, index string) {
+	if m, ok := r.vars[name].(assocArray); ok {
+		delete(m, index)
+		return
+	}
+	expr, err := parseArithm(index)
+	if err != nil {
+		r.errf("unset: %s: bad array subscript\n", index)
+		return
+	}
+	i := r.arithm(expr)
+	arr, ok := r.vars[name].(indexArray)
+	if !ok {
+		if i == 0 {
+			r.delVar(name)
+		}
+		return
+	}
+	if i < 0 {
+		i += arr.next()
+	}
+	delete(arr, i)
+}
+
+// varNames returns the names of all the set variables that start with
+// prefix, in alphabetical order.
+func (r *Runner) varNames(prefix string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for name := range r.cmdVars {
+		add(name)
+	}
+	for name := range r.vars {
+		add(name)
+	}
+	for name := range r.envMap {
+		add(name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (r *Runner) setFunc(name string, body *syntax.Stmt) {
 	if r.funcs == nil {
 		r.funcs = make(map[string]*syntax.Stmt, 4)
@@ -186,6 +367,37 @@ func (r *Runner) setFunc(name string, body *syntax.Stmt) {
 
 // Run starts the interpreter and returns any error.
 func (r *Runner) Run() error {
+	if err := r.setup(); err != nil {
+		return err
+	}
+	r.topStmts(r.File.Stmts)
+	return r.finish()
+}
+
+// RunReader is like Run, but it parses the program from src with an
+// optional name instead of using File. Like in shells, each line is
+// run as soon as it is parsed, before reading the following lines.
+// Aliases are only expanded when running programs this way, as the
+// statements in File were parsed before any aliases were defined.
+func (r *Runner) RunReader(src io.Reader, name string) error {
+	if err := r.setup(); err != nil {
+		return err
+	}
+	p := syntax.NewParser(syntax.Variant(r.Variant),
+		syntax.ExpandAliases(r.lookupAlias))
+	_, err := p.Stmts(src, name, func(f *syntax.File, stmts []*syntax.Stmt) bool {
+		r.File = f
+		r.topStmts(stmts)
+		return !r.stop()
+	})
+	if err != nil && r.err == nil {
+		return err
+	}
+	return r.finish()
+}
+
+// setup prepares the runner to run a program.
+func (r *Runner) setup() error {
 	if r.Context == nil {
 		r.Context = context.Background()
 	}
@@ -201,6 +413,12 @@ func (r *Runner) Run() error {
 		name, val := kv[:i], kv[i+1:]
 		r.envMap[name] = val
 	}
+	if r.hashes == nil {
+		r.hashes = &hashTable{}
+	}
+	if !r.umaskSet {
+		r.umask, r.umaskSet = processUmask(), true
+	}
 	if r.Dir == "" {
 		dir, err := os.Getwd()
 		if err != nil {
@@ -208,7 +426,11 @@ func (r *Runner) Run() error {
 		}
 		r.Dir = dir
 	}
-	r.stmts(r.File.Stmts)
+	return nil
+}
+
+// finish returns the error that the program ended with, if any.
+func (r *Runner) finish() error {
 	r.lastExit()
 	if r.err == ExitCode(0) {
 		r.err = nil
@@ -216,6 +438,15 @@ func (r *Runner) Run() error {
 	return r.err
 }
 
+// shellName returns the value of $0, which is the name of the file
+// being run.
+func (r *Runner) shellName() string {
+	if r.File != nil && r.File.Name != "" {
+		return r.File.Name
+	}
+	return "gosh"
+}
+
 func (r *Runner) outf(format string, a ...interface{}) {
 	fmt.Fprintf(r.Stdout, format, a...)
 }
@@ -227,16 +458,25 @@ func (r *Runner) errf(format string, a ...interface{}) {
 func (r *Runner) fields(words []*syntax.Word) []string {
 	fields := make([]string, 0, len(words))
 	for _, word := range words {
-		fields = append(fields, r.wordParts(word.Parts, false)...)
+		for _, word := range r.expandBraces(word) {
+			fields = append(fields, r.wordParts(word.Parts, modeFields)...)
+		}
 	}
 	return fields
 }
 
+// loneWord expands a word into a single string, like in assignments.
+// No field splitting is done, and elements such as the ones in "$@"
+// are joined with spaces.
 func (r *Runner) loneWord(word *syntax.Word) string {
 	if word == nil {
 		return ""
 	}
-	return strings.Join(r.wordParts(word.Parts, false), "")
+	return r.loneParts(word.Parts)
+}
+
+func (r *Runner) loneParts(wps []syntax.WordPart) string {
+	return strings.Join(r.wordParts(wps, modeLone), " ")
 }
 
 func (r *Runner) stop() bool {
@@ -258,6 +498,7 @@ func (r *Runner) stmt(st *syntax.Stmt) {
 		r.bgShells.Add(1)
 		r2 := *r
 		r2.bgShells = sync.WaitGroup{}
+		r2.hashes = r.hashes.fork()
 		go func() {
 			r2.stmtSync(st)
 			r.bgShells.Done()
@@ -270,41 +511,87 @@ func (r *Runner) stmt(st *syntax.Stmt) {
 func (r *Runner) assignValue(as *syntax.Assign) varValue {
 	prev, _ := r.lookupVar(as.Name.Value)
 	if as.Value != nil {
-		s := r.loneWord(as.Value)
+		s := r.assignWord(as.Value)
+		if m, ok := prev.(assocArray); ok && (as.Index != nil || as.Key != nil) {
+			k := r.assocKey(as.Index, as.Key)
+			if as.Append {
+				s = m[k] + s
+			}
+			m[k] = s
+			return m
+		}
+		if as.Index != nil {
+			arr := toIndexArray(prev)
+			i := r.arithm(as.Index)
+			if i < 0 {
+				i += arr.next()
+			}
+			if as.Append {
+				s = arr[i] + s
+			}
+			arr[i] = s
+			return arr
+		}
 		if !as.Append || prev == nil {
 			return s
 		}
 		switch x := prev.(type) {
 		case string:
 			return x + s
-		case []string:
-			if len(x) == 0 {
-				return []string{s}
-			}
+		case indexArray:
 			x[0] += s
 			return x
 		}
 		return s
 	}
 	if as.Array != nil {
-		strs := make([]string, len(as.Array.Elems))
-		for i, elem := range as.Array.Elems {
-			strs[i] = r.loneWord(elem.Value)
+		if m, ok := prev.(assocArray); ok {
+			if !as.Append {
+				m = make(assocArray, len(as.Array.Elems))
+			}
+			for _, elem := range as.Array.Elems {
+				k := r.assocKey(elem.Index, elem.Key)
+				m[k] = r.loneWord(elem.Value)
+			}
+			return m
 		}
-		if !as.Append || prev == nil {
-			return strs
+		arr := make(indexArray, len(as.Array.Elems))
+		i := 0
+		if as.Append {
+			arr = toIndexArray(prev)
+			i = arr.next()
 		}
-		switch x := prev.(type) {
-		case string:
-			return append([]string{x}, strs...)
-		case []string:
-			return append(x, strs...)
+		for _, elem := range as.Array.Elems {
+			if elem.Index != nil {
+				i = r.arithm(elem.Index)
+				arr[i] = r.loneWord(elem.Value)
+				i++
+				continue
+			}
+			// like command arguments, elements are
+			// subject to brace expansion and splitting
+			for _, field := range r.fields([]*syntax.Word{elem.Value}) {
+				arr[i] = field
+				i++
+			}
 		}
-		return strs
+		return arr
 	}
 	return nil
 }
 
+// toIndexArray returns val as an indexed array, converting a string
+// into an array with it as the first element.
+func toIndexArray(val varValue) indexArray {
+	switch x := val.(type) {
+	case string:
+		return indexArray{0: x}
+	case indexArray:
+		return x
+	}
+	return indexArray{}
+}
+
 func (r *Runner) stmtSync(st *syntax.Stmt) {
 	oldVars := r.cmdVars
 	for _, as := range st.Assigns {
@@ -319,19 +606,23 @@ func (r *Runner) stmtSync(st *syntax.Stmt) {
 		r.cmdVars[as.Name.Value] = val
 	}
 	oldIn, oldOut, oldErr := r.Stdin, r.Stdout, r.Stderr
+	redirsOK := true
 	for _, rd := range st.Redirs {
 		cls, err := r.redir(rd)
 		if err != nil {
-			r.exit = 1
-			return
+			redirsOK = false
+			break
 		}
 		if cls != nil {
 			defer cls.Close()
 		}
 	}
-	if st.Cmd == nil {
+	switch {
+	case !redirsOK:
+		r.exit = 1
+	case st.Cmd == nil:
 		r.exit = 0
-	} else {
+	default:
 		r.cmd(st.Cmd)
 	}
 	if st.Negated {
@@ -357,10 +648,14 @@ func (r *Runner) cmd(cm syntax.Command) {
 		r.stmts(x.Stmts)
 	case *syntax.Subshell:
 		r2 := *r
+		r2.hashes = r.hashes.fork()
 		r2.stmts(x.Stmts)
 		r.exit = r2.exit
 	case *syntax.CallExpr:
 		fields := r.fields(x.Args)
+		if r.err == errExpansion {
+			break
+		}
 		r.call(x.Args[0].Pos(), fields[0], fields[1:])
 	case *syntax.BinaryCmd:
 		switch x.Op {
@@ -377,6 +672,7 @@ func (r *Runner) cmd(cm syntax.Command) {
 		case syntax.Pipe, syntax.PipeAll:
 			pr, pw := io.Pipe()
 			r2 := *r
+			r2.hashes = r.hashes.fork()
 			r2.Stdin = r.Stdin
 			r2.Stdout = pw
 			if x.Op == syntax.PipeAll {
@@ -465,10 +761,29 @@ func (r *Runner) cmd(cm syntax.Command) {
 			r.exit = 1
 		}
 	case *syntax.DeclClause:
-		if len(x.Opts) > 0 {
-			r.runErr(cm.Pos(), "unhandled declare opts")
+		var valType string
+		for _, opt := range r.fields(x.Opts) {
+			switch opt {
+			case "-a", "-A":
+				valType = opt
+			default:
+				r.runErr(cm.Pos(), "unhandled declare opts")
+			}
 		}
 		for _, as := range x.Assigns {
+			switch valType {
+			case "-a":
+				if _, ok := r.vars[as.Name.Value].(indexArray); !ok {
+					r.setVar(as.Name.Value, indexArray{})
+				}
+			case "-A":
+				if _, ok := r.vars[as.Name.Value].(assocArray); !ok {
+					r.setVar(as.Name.Value, assocArray{})
+				}
+			}
+			if as.Naked && valType != "" {
+				continue
+			}
 			r.setVar(as.Name.Value, r.assignValue(as))
 		}
 	default:
@@ -482,6 +797,21 @@ func (r *Runner) stmts(stmts []*syntax.Stmt) {
 	}
 }
 
+// errExpansion stops the runner after an expansion error, such as a
+// negative array slice length. Like in bash, it only aborts the
+// top-level statement that the error happened in.
+var errExpansion = errors.New("expansion error")
+
+func (r *Runner) topStmts(stmts []*syntax.Stmt) {
+	for _, stmt := range stmts {
+		r.stmt(stmt)
+		if r.err == errExpansion {
+			r.err = nil
+			r.exit = 1
+		}
+	}
+}
+
 func match(pattern, name string) bool {
 	matched, _ := path.Match(pattern, name)
 	return matched
@@ -524,9 +854,9 @@ func (r *Runner) redir(rd *syntax.Redirect) (io.Closer, error) {
 	case syntax.RdrOut, syntax.RdrAll:
 		mode = os.O_RDWR | os.O_CREATE | os.O_TRUNC
 	}
-	f, err := os.OpenFile(arg, mode, 0644)
+	f, err := openFile(r.absPath(arg), mode, r.umask)
 	if err != nil {
-		// TODO: print to stderr?
+		r.errf("%s: %s\n", arg, osErrText(err))
 		return nil, err
 	}
 	switch rd.Op {
@@ -560,16 +890,32 @@ func (r *Runner) loopStmtsBroken(stmts []*syntax.Stmt) bool {
 	return false
 }
 
-func (r *Runner) wordParts(wps []syntax.WordPart, quoted bool) []string {
+// A wordMode is how wordParts expands the parts of a word.
+type wordMode uint8
+
+const (
+	// split into fields, like command arguments
+	modeFields wordMode = iota
+	// without field splitting, like assignment values
+	modeLone
+	// within double quotes, where tilde prefixes are not expanded
+	modeDblQuoted
+)
+
+func (r *Runner) wordParts(wps []syntax.WordPart, mode wordMode) []string {
+	quoted := mode != modeFields
 	var parts []string
 	var curBuf bytes.Buffer
-	allowEmpty := false
+	// whether the current field must be kept even if empty, e.g.
+	// if it contains quotes
+	keepField := false
 	flush := func() {
-		if curBuf.Len() == 0 {
+		if curBuf.Len() == 0 && !keepField {
 			return
 		}
 		parts = append(parts, curBuf.String())
 		curBuf.Reset()
+		keepField = false
 	}
 	splitAdd := func(val string) {
 		// TODO: use IFS
@@ -584,78 +930,117 @@ func (r *Runner) wordParts(wps []syntax.WordPart, quoted bool) []string {
 		switch x := wp.(type) {
 		case *syntax.Lit:
 			s := x.Value
-			if i > 0 || len(s) == 0 || s[0] != '~' {
-			} else if len(s) < 2 || s[1] == '/' {
-				// TODO: ~someuser
-				s = r.getVar("HOME") + s[1:]
+			if i == 0 && mode != modeDblQuoted {
+				s = r.expandTilde(s, len(wps) == 1)
 			}
+			keepField = keepField || quoted
 			curBuf.WriteString(s)
 		case *syntax.SglQuoted:
-			allowEmpty = true
-			curBuf.WriteString(x.Value)
+			keepField = true
+			if x.Dollar {
+				curBuf.WriteString(ansiCString(x.Value))
+			} else {
+				curBuf.WriteString(x.Value)
+			}
 		case *syntax.DblQuoted:
-			allowEmpty = true
-			if len(x.Parts) == 1 {
-				pe, _ := x.Parts[0].(*syntax.ParamExp)
-				if elems := r.quotedElems(pe); elems != nil {
-					for i, elem := range elems {
-						if i > 0 {
-							flush()
-						}
-						curBuf.WriteString(elem)
-					}
-					continue
-				}
+			if len(x.Parts) == 0 {
+				keepField = true
+			}
+			qparts := x.Parts
+			if x.Dollar {
+				qparts = r.translated(x)
 			}
-			for _, str := range r.wordParts(x.Parts, true) {
+			for i, str := range r.wordParts(qparts, modeDblQuoted) {
+				if i > 0 {
+					flush()
+				}
+				keepField = true
 				curBuf.WriteString(str)
 			}
 		case *syntax.ParamExp:
-			val := r.paramExp(x)
-			if quoted {
-				curBuf.WriteString(val)
-			} else {
-				splitAdd(val)
+			elems, list := r.paramElems(x)
+			if !quoted {
+				splitAdd(strings.Join(elems, " "))
+				break
+			}
+			if !list {
+				elems = []string{strings.Join(elems, " ")}
+			}
+			for i, elem := range elems {
+				if i > 0 {
+					flush()
+				}
+				keepField = true
+				curBuf.WriteString(elem)
 			}
 		case *syntax.CmdSubst:
 			r2 := *r
+			r2.hashes = r.hashes.fork()
 			var buf bytes.Buffer
 			r2.Stdout = &buf
 			r2.stmts(x.Stmts)
 			val := strings.TrimRight(buf.String(), "\n")
 			if quoted {
+				keepField = true
 				curBuf.WriteString(val)
 			} else {
 				splitAdd(val)
 			}
 		case *syntax.ArithmExp:
+			keepField = keepField || quoted
 			curBuf.WriteString(strconv.Itoa(r.arithm(x.X)))
 		default:
 			r.runErr(wp.Pos(), "unhandled word part: %T", x)
 		}
 	}
 	flush()
-	if allowEmpty && len(parts) == 0 {
-		parts = append(parts, "")
-	}
 	return parts
 }
 
 func (r *Runner) call(pos syntax.Pos, name string, args []string) {
 	if body := r.funcs[name]; body != nil {
 		// stack them to support nested func calls
-		oldArgs := r.args
-		r.args = args
+		oldArgs, oldOpts := r.args, r.optState
+		r.args, r.optState = args, getopts{}
 		r.stmt(body)
-		r.args = oldArgs
+		r.args, r.optState = oldArgs, oldOpts
+		return
+	}
+	r.callNoFuncs(pos, name, args, false)
+}
+
+// callNoFuncs is like call, but skipping functions like the command
+// builtin does. If stdPath is true, programs are searched for in the
+// default PATH instead of the current one.
+func (r *Runner) callNoFuncs(pos syntax.Pos, name string, args []string, stdPath bool) {
+	if fn := r.Builtins[name]; fn != nil {
+		r.exit = r.callBuiltinFunc(fn, args)
 		return
 	}
 	if isBuiltin(name) {
 		r.exit = r.builtinCode(pos, name, args)
 		return
 	}
-	cmd := exec.CommandContext(r.Context, name, args...)
+	var path string
+	if stdPath {
+		if paths := r.findExecutables(name, defaultPath, false); len(paths) > 0 {
+			path = paths[0]
+		}
+	} else {
+		path, _ = r.lookPath(name)
+	}
+	if path == "" {
+		r.exit = r.notFound(pos, name, args)
+		return
+	}
+	cmd := exec.Command(r.absPath(path), args...)
+	cmd.Args[0] = name
 	cmd.Env = r.Env
+	// like in shells, PWD and OLDPWD are exported
+	cmd.Env = append(cmd.Env, "PWD="+r.Dir)
+	if old, ok := r.lookupVar("OLDPWD"); ok {
+		cmd.Env = append(cmd.Env, "OLDPWD="+varStr(old))
+	}
 	for name, val := range r.cmdVars {
 		cmd.Env = append(cmd.Env, name+"="+varStr(val))
 	}
@@ -663,22 +1048,124 @@ func (r *Runner) call(pos syntax.Pos, name string, args []string) {
 	cmd.Stdin = r.Stdin
 	cmd.Stdout = r.Stdout
 	cmd.Stderr = r.Stderr
-	err := cmd.Run()
+	if r.ProcessGroups {
+		setProcGroup(cmd)
+	}
+	var err error
+	withUmask(r.umask, func() {
+		err = cmd.Start()
+	})
+	if err == nil {
+		done := make(chan struct{})
+		go r.killOnCancel(cmd, done)
+		err = cmd.Wait()
+		close(done)
+		// stop if the program was killed due to the context
+		r.stop()
+	}
 	switch x := err.(type) {
 	case *exec.ExitError:
 		// started, but errored - default to 1 if OS
 		// doesn't have exit statuses
 		r.exit = 1
 		if status, ok := x.Sys().(syscall.WaitStatus); ok {
-			r.exit = status.ExitStatus()
+			if status.Signaled() {
+				// like shells, report 128+N for signal N
+				r.exit = 128 + int(status.Signal())
+			} else {
+				r.exit = status.ExitStatus()
+			}
 		}
-	case *exec.Error:
+	case *exec.Error, *os.PathError:
 		// did not start
-		// TODO: can this be anything other than
-		// "command not found"?
-		r.exit = 127
-		// TODO: print something?
+		r.errf("%s: %s\n", name, osErrText(err))
+		r.exit = 126
 	default:
 		r.exit = 0
 	}
 }
+
+// notFound handles a command that could not be run because no
+// executable was found, printing why and returning its exit status.
+// Like in bash, if a command_not_found_handle function is defined, it
+// is called in a subshell with the command's name and arguments
+// instead.
+func (r *Runner) notFound(pos syntax.Pos, name string, args []string) int {
+	if strings.Contains(name, "/") {
+		info, err := os.Stat(r.absPath(name))
+		switch {
+		case err != nil:
+			r.errf("%s: %s\n", name, osErrText(err))
+			return 127
+		case info.IsDir():
+			r.errf("%s: Is a directory\n", name)
+		default:
+			r.errf("%s: Permission denied\n", name)
+		}
+		return 126
+	}
+	if r.funcs["command_not_found_handle"] != nil && !r.inNotFound {
+		r2 := *r
+		// don't call the handler again for commands that it
+		// cannot find
+		r2.inNotFound = true
+		r2.call(pos, "command_not_found_handle", append([]string{name}, args...))
+		return r2.exit
+	}
+	r.errf("%s: command not found\n", name)
+	return 127
+}
+
+// osErrText returns the description of an error from the operating
+// system, without the operation or file that it happened with. It is
+// capitalized like the messages that shells print, such as "No such
+// file or directory".
+func osErrText(err error) string {
+	switch x := err.(type) {
+	case *os.PathError:
+		err = x.Err
+	case *exec.Error:
+		err = x.Err
+	}
+	s := err.Error()
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// defaultKillTimeout is the default value for Runner.KillTimeout.
+const defaultKillTimeout = 2 * time.Second
+
+// killOnCancel stops a started command if the runner's context is
+// cancelled before done is closed. It first sends SIGTERM, and then
+// SIGKILL if the command is still running after KillTimeout. When
+// using process groups, SIGKILL is sent to the group in any case, as
+// descendants of the command may still be running.
+func (r *Runner) killOnCancel(cmd *exec.Cmd, done <-chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-r.Context.Done():
+	}
+	group := r.ProcessGroups
+	signalCmd(cmd, syscall.SIGTERM, group)
+	timeout := r.KillTimeout
+	if timeout == 0 {
+		timeout = defaultKillTimeout
+	}
+	if timeout < 0 {
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		if !group {
+			return
+		}
+		<-timer.C
+	case <-timer.C:
+	}
+	signalCmd(cmd, syscall.SIGKILL, group)
+}
@@ -67,9 +67,11 @@ var fileCases = []struct {
 	{"printf", "usage: printf format [arguments]\nexit status 2 #JUSTERR"},
 	{"break", "break is only useful in a loop #JUSTERR"},
 	{"continue", "continue is only useful in a loop #JUSTERR"},
-	{"cd a b", "usage: cd [dir]\nexit status 2 #JUSTERR"},
+	{"cd a b", "usage: cd [-L|-P] [dir]\nexit status 2 #JUSTERR"},
 	{"shift a", "usage: shift [n]\nexit status 2 #JUSTERR"},
-	{"shouldnotexist", "exit status 127 #JUSTERR"},
+	{"shouldnotexist", "shouldnotexist: command not found\nexit status 127 #JUSTERR"},
+	{"sh -c 'kill -9 $$'", "exit status 137 #IGNORE"},
+	{"sh -c 'kill -TERM $$'; echo $?", "143\n #IGNORE"},
 	{
 		"for i in 1; do continue a; done",
 		"usage: continue [n]\nexit status 2 #JUSTERR",
@@ -90,6 +92,16 @@ var fileCases = []struct {
 	{"echo -e '\a'", "\a\n"},
 	{"echo -E '\n'", "\n\n"},
 	{"echo -x foo", "-x foo\n"},
+	{`echo -e 'a\tb\x41\0101\u00e9\q'`, "a\tbAA\u00e9\\q\n"},
+	{`echo -e 'a\cb' c; echo d`, "ad\n"},
+	{`echo -ne 'x\n'; echo -nE 'y\n'`, "x\ny\\n"},
+	{"echo -nx foo; echo --", "-nx foo\n--\n"},
+	{`echo 'a\tb'; shopt -s xpg_echo; echo 'a\tb'; echo -E 'a\tb'`, "a\\tb\na\tb\na\\tb\n"},
+	{
+		"shopt xpg_echo; shopt -p xpg_echo; shopt -s xpg_echo; shopt xpg_echo",
+		"xpg_echo       \toff\nshopt -u xpg_echo\nxpg_echo       \ton\n",
+	},
+	{"shopt -s nope", "shopt: nope: invalid shell option name\nexit status 1 #JUSTERR"},
 
 	// printf
 	{"printf foo", "foo"},
@@ -103,6 +115,11 @@ var fileCases = []struct {
 	{`echo a'b'c"d"e`, "abcde\n"},
 	{`a=" b c "; echo "$a"`, " b c \n"},
 	{`echo "$(echo ' b c ')"`, " b c \n"},
+	{`echo $'foo\'bar' $"foo bar"`, "foo'bar foo bar\n"},
+	{
+		`printf '%s' $'a\tb\x41\u00e9\101\cA\e[\\\'' | od -An -c | tr -s ' '`,
+		" a \\t b A 303 251 A 001 033 [ \\ '\n",
+	},
 
 	// vars
 	{"foo=bar; echo $foo", "bar\n"},
@@ -208,6 +225,80 @@ var fileCases = []struct {
 		`a='"\n'; printf "%s %s" "${a}" "${a@E}"`,
 		"\"\\n \"\n",
 	},
+	{
+		"a=\"it's\"; b='x\ny'; c=; echo ${a@Q} ${b@Q} ${c@Q}",
+		`'it'\''s' $'x\ny' ''` + "\n",
+	},
+	{
+		`a='x  $y "z"'; eval "b=${a@Q}"; [[ "$a" == "$b" ]]`,
+		"",
+	},
+	{
+		`a='\x41é\101\cA\e'; printf '%s' "${a@E}" | od -An -c | tr -s ' '`,
+		" A 303 251 A 001 033\n",
+	},
+	{
+		`mkdir x; cd x; a='\W \\ \[\]x'; echo "${a@P}"; cd ..; rmdir x`,
+		"x \\ x\n",
+	},
+	{
+		`a='<\D{%Y-%m-%d %% %j}>'; [ "${a@P}" = "$(date '+<%Y-%m-%d %% %j>')" ] && echo ok`,
+		"ok\n",
+	},
+	{
+		`a='\D x \D{} \D{%Q}'; b=${a@P}; echo "${b%% *}" "${b##* }" ${#b}`,
+		"\\D %Q 16\n",
+	},
+	{
+		`a='\s'; echo "${a@P}"`,
+		"gosh\n #IGNORE",
+	},
+	{
+		`a=(1 '2 3'); b=x; echo "${a[@]@A}"; echo "${b@A}"; echo "${nope@A}"`,
+		"declare -a a=([0]=\"1\" [1]=\"2 3\")\nb='x'\n\n",
+	},
+	{
+		`declare -A m=([k]=v [x]="a b"); a=(1); b=x; echo "${m@a} ${a@a} ${b@a} ${INTERP_GLOBAL@a}"`,
+		"A a  x\n",
+	},
+	{
+		`declare -A m=([k]=v [x]="a b"); echo "${m[@]@K}"; for e in "${m[@]@k}"; do echo "[$e]"; done`,
+		"k \"v\" x \"a b\" \n[k]\n[v]\n[x]\n[a b]\n #IGNORE",
+	},
+	{
+		`declare -A m; m[k]=v; m["a b"]=c; echo ${m[k]} ${m["a b"]}; echo ${#m[@]}; for k in "${!m[@]}"; do echo "$k=${m[$k]}"; done | sort`,
+		"v c\n2\na b=c\nk=v\n",
+	},
+	{
+		`declare -A m=([k]=v [x]=y); unset m[k]; echo "${m@A}"`,
+		"declare -A m=([x]=\"y\" )\n",
+	},
+
+	// brace expansion
+	{
+		"echo a{b,c}d {x,y}{1,2}; echo {a,{b,c}} {} {a} a{b",
+		"abd acd x1 x2 y1 y2\na b c {} {a} a{b\n",
+	},
+	{
+		"echo {1..3} {3..1} {1..10..3} {01..3} {-2..2..2} {a..e..2} {e..c}",
+		"1 2 3 3 2 1 1 4 7 10 01 02 03 -2 0 2 a c e e d c\n",
+	},
+	{
+		"echo {1..9223372036854775807..4611686018427387904} {-9223372036854775807..-9223372036854775808}",
+		"1 4611686018427387905 -9223372036854775807 -9223372036854775808\n",
+	},
+	{
+		`echo "{a,b}" {a,"b c"} {a..b,c} x{,y}`,
+		"{a,b} a b c a..b c x xy\n",
+	},
+	{
+		`a=(x{1,2}); for e in {"a b",c}; do echo "$e"; done; echo ${a[@]}`,
+		"a b\nc\nx1 x2\n",
+	},
+	{
+		"mkdir -p d/{x,y} && ls d && rm -r d",
+		"x\ny\n",
+	},
 
 	// if
 	{
@@ -366,13 +457,73 @@ var fileCases = []struct {
 		"[[ ~ == $HOME ]] && [[ ~/foo == $HOME/foo ]]",
 		"",
 	},
+	{
+		`HOME=/h; echo ~ ~/x ~"/x" x~ ~nouser_sh/x`,
+		"/h /h/x ~/x x~ ~nouser_sh/x\n",
+	},
+	{
+		`HOME=/h; a=~/b:~/c:x~; b=x:~ c=~nouser_sh:~; echo $a $b $c`,
+		"/h/b:/h/c:x~ x:/h ~nouser_sh:/h\n",
+	},
+	{
+		`HOME=/h; echo "~" '~' "~/x"; a="~"; b="~/x"; c=x:"~"; echo $a $b $c`,
+		"~ ~ ~/x\n~ ~/x x:~\n",
+	},
+	{
+		`cd /; OLDPWD=/x; echo ~+ ~0 ~+0 ~-0 ~- ~1`,
+		"/ / / / /x ~1\n",
+	},
+	{
+		`HOME=$PWD; mkdir x; cd x; a='\w'; echo "${a@P}"; cd ..; rmdir x`,
+		"~/x\n",
+	},
 	{
 		`w="$HOME"; cd; [[ $PWD == $w ]] && echo foo`,
 		"foo\n",
 	},
 	{
 		"cd noexist",
-		"exit status 1 #JUSTERR",
+		"cd: noexist: No such file or directory\nexit status 1 #JUSTERR",
+	},
+	{
+		"touch f; cd f; echo $?; cd f/x; rm f",
+		"cd: f: Not a directory\n1\ncd: f/x: Not a directory\n #IGNORE",
+	},
+	{
+		"cd /; cd /usr; cd -; echo $OLDPWD; cd -- /usr/bin/..//./lib; pwd",
+		"/\n/usr\n/usr/lib\n",
+	},
+	{
+		"unset OLDPWD; cd -",
+		"cd: OLDPWD not set\nexit status 1 #JUSTERR",
+	},
+	{
+		`mkdir -p p/sub; CDPATH=:$PWD/p; cd sub | sed 's@.*/p/@@'; cd sub >/dev/null; cd p; cd ../..; rm -r p`,
+		"sub\ncd: p: No such file or directory\n #IGNORE",
+	},
+	{
+		`mkdir p; ln -s p l; cd l; pwd | sed 's@.*/@@'; cd ..; cd -P l; pwd | sed 's@.*/@@'; cd ..; rm -r p l`,
+		"l\np\n",
+	},
+	{
+		`cd /usr; cd /; bash -c 'echo $PWD $OLDPWD'`,
+		"/ /usr\n",
+	},
+	{
+		"HOME=/usr; cd /; pushd /usr; pushd /usr/lib; pushd; dirs -v; dirs -l; dirs +1; dirs -0",
+		"~ /\n~/lib ~ /\n~ ~/lib /\n 0  ~\n 1  ~/lib\n 2  /\n/usr /usr/lib /\n~/lib\n/\n",
+	},
+	{
+		"cd /; pushd /usr >/dev/null; pushd /usr/lib >/dev/null; pushd +2; pushd -1; popd +1; popd; popd; popd; echo $?",
+		"/ /usr/lib /usr\n/usr/lib /usr /\n/usr/lib /\n/\npopd: directory stack empty\npopd: directory stack empty\n1\n #IGNORE",
+	},
+	{
+		"cd /; pushd -n /usr; echo $PWD; dirs -c; dirs; pushd +1; pushd",
+		"/ /usr\n/\n/\npushd: directory stack empty\npushd: no other directory\nexit status 1 #JUSTERR",
+	},
+	{
+		"cd /; pushd /usr >/dev/null; echo ~1; popd -n; echo $PWD",
+		"/\n/usr\n/usr\n",
 	},
 	{
 		"mkdir -p a/b && cd a && cd b && cd ../.. && rm -rf a",
@@ -571,7 +722,7 @@ var fileCases = []struct {
 	},
 	{
 		"echo foo >/",
-		"exit status 1 #JUSTERR",
+		"/: Is a directory\nexit status 1 #JUSTERR",
 	},
 	{
 		"echo foo 1>&1 | sed 's/o/a/g'",
@@ -982,6 +1133,49 @@ var fileCases = []struct {
 	{"echo() { :; }; type echo | sed 1q", "echo is a function\n"},
 	{"type bash | sed 's@/.*@/binpath@'", "bash is /binpath\n"},
 	{"type noexist", "type: noexist: not found\nexit status 1 #JUSTERR"},
+	{
+		`mkdir bin; echo -e '#!/bin/sh\necho hi' >bin/foo; chmod +x bin/foo; PATH=bin:$PATH; foo; type -t foo; cd bin; foo 2>/dev/null; echo $?; cd ..; rm -r bin`,
+		"hi\nfile\n127\n",
+	},
+	{
+		"type -P echo | sed 's@.*/@@'; type -t echo if; f() { :; }; type -t f; type -p f; echo $?; type -f -t f; echo $?",
+		"echo\nbuiltin\nkeyword\nfunction\n0\n1\n",
+	},
+	{"type -t noexist", "exit status 1"},
+	{
+		"PATH=/bin; hash -r; command -v cat; type cat; cat </dev/null; type cat",
+		"/bin/cat\ncat is /bin/cat\ncat is hashed (/bin/cat)\n",
+	},
+
+	// command
+	{"command", ""},
+	{
+		"f() { :; }; command -v f; command -v echo; command -V if; command -V nope; echo $?; command -v nope; echo $?",
+		"f\necho\nif is a shell keyword\ncommand: nope: not found\n1\n1\n #IGNORE",
+	},
+	{
+		"echo() { printf 'fn\n'; }; command echo foo; PATH=/nonexist; command -p true; builtin echo $?; command -p cat </dev/null; builtin echo $?",
+		"foo\n0\n0\n",
+	},
+	{"command -x", "usage: command [-pVv] command [arg ...]\nexit status 2 #JUSTERR"},
+
+	// hash
+	{
+		"PATH=/bin; hash; hash cat; hash; hash -l; hash -t cat; hash -d cat; hash -d cat; echo $?; hash nope; echo $?; hash cat; PATH=/bin; hash",
+		"hash: hash table empty\nhits\tcommand\n   0\t/bin/cat\nbuiltin hash -p /bin/cat cat\n/bin/cat\nhash: cat: not found\n1\nhash: nope: not found\n1\nhash: hash table empty\n #IGNORE",
+	},
+	{
+		"hash cat; PATH=/nonexist cat </dev/null; echo $?; cat </dev/null; echo $?",
+		"cat: command not found\n127\n0\n #IGNORE",
+	},
+	{
+		"hash -r; PATH=/bin; cat </dev/null; cat </dev/null; hash",
+		"hits\tcommand\n   2\t/bin/cat\n",
+	},
+	{
+		"PATH=/bin; hash cat; (hash -r); hash -t cat; (PATH=/bin); hash -t cat; (hash -p /x cat); echo $(hash -r) | cat; hash -t cat",
+		"/bin/cat\n/bin/cat\n\n/bin/cat\n",
+	},
 
 	// eval
 	{"eval", ""},
@@ -991,6 +1185,72 @@ var fileCases = []struct {
 	{"eval 'exit 1'", "exit status 1"},
 	{"eval '('", "eval: 1:1: reached EOF without matching ( with )\nexit status 1 #JUSTERR"},
 
+	// getopts
+	{"getopts", "getopts: usage: getopts optstring name [arg ...]\nexit status 2 #JUSTERR"},
+	{
+		`set -- -ab -c foo -dbar x y; while getopts abc:d: o; do echo "$o ${OPTARG-unset} $OPTIND"; done; echo $o $OPTIND; shift $((OPTIND-1)); echo "$@"`,
+		"a unset 1\nb unset 2\nc foo 4\nd bar 5\n? 5\nx y\n",
+	},
+	{
+		`while getopts :ab: o -x -b; do echo "$o $OPTARG $OPTIND"; done`,
+		"? x 2\n: b 3\n",
+	},
+	{
+		`while getopts ab: o -x -b; do echo "$o ${OPTARG-unset} $OPTIND"; done`,
+		"gosh: illegal option -- x\n? unset 2\ngosh: option requires an argument -- b\n? unset 3\n #IGNORE",
+	},
+	{"OPTERR=0; getopts a o -x; echo $? $o", "0 ?\n"},
+	{"echo $0 ${0}", "gosh gosh\n #IGNORE"},
+	{"getopts a o -- -a; echo $? $OPTIND; getopts a o -a; echo $? $o", "1 2\n1 ?\n"},
+	{
+		`f() { OPTIND=1; while getopts x o "$@"; do echo "f $o"; done; }; set -- -ab; getopts ab o; echo $o; f -x; OPTIND=1; getopts ab o; echo $o`,
+		"a\nf x\na\n",
+	},
+	{
+		`f() { getopts x o -x; echo "f $o"; }; set -- -ab; getopts ab o; echo $o; f; OPTIND=1; getopts ab o; getopts ab o; echo $o`,
+		"a\nf x\nb\n",
+	},
+
+	// alias
+	{"alias", ""},
+	{"alias ll=x e='echo '; alias; alias -p ll", "alias e='echo '\nalias ll='x'\nalias ll='x'\n #IGNORE"},
+	{"alias nope; echo $?", "alias: nope: not found\n1\n #IGNORE"},
+	{"alias 'a/b=c'", "alias: a/b: invalid alias name\nexit status 1 #JUSTERR"},
+	{"alias a=x; unalias a; alias; unalias a", "unalias: a: not found\nexit status 1 #JUSTERR"},
+	{"alias a=x b=y; unalias -a; alias", ""},
+	{"unalias", "unalias: usage: unalias [-a] name [name ...]\nexit status 2 #JUSTERR"},
+	{"alias ll='echo ll'\nll a", "ll: command not found\nexit status 127 #JUSTERR"},
+	{
+		"shopt -s expand_aliases\nalias ll='echo hi'\nll",
+		"ll: command not found\nexit status 127 #IGNORE",
+	},
+
+	// umask
+	{
+		"umask 022; umask; umask -S; umask -p; umask -p -S",
+		"0022\nu=rwx,g=rx,o=rx\numask 0022\numask -S u=rwx,g=rx,o=rx\n",
+	},
+	{
+		"umask u=rwx,g=rx,o=; umask; umask g-x,o+r; umask; umask =rx; umask; umask 1777; umask",
+		"0027\n0033\n0222\n0777\n",
+	},
+	{
+		"umask 9; echo $?; umask u=q; echo $?",
+		"umask: 9: octal number out of range\n1\numask: `q': invalid symbolic mode character\n1\n #IGNORE",
+	},
+	{
+		"umask 027; echo >f; mkdir d; stat -c %a f d; rm -r f d",
+		"640\n750\n",
+	},
+	{
+		"umask 022; (umask 077; echo >f); umask; stat -c %a f; rm f",
+		"0022\n600\n",
+	},
+	{
+		"umask 0; echo >f; echo >>f; stat -c %a f; rm f",
+		"666\n",
+	},
+
 	// arrays
 	{
 		"a=foo; echo ${a[0]} ${a[@]} ${a[x]}; echo ${a[1]}",
@@ -1036,6 +1296,74 @@ var fileCases = []struct {
 		`a=('a  1' 'b  2'); for e in "${a[@]}"; do echo "$e"; done`,
 		"a  1\nb  2\n",
 	},
+	{
+		`a=(a '' c); for e in "x${a[@]}y"; do echo "[$e]"; done`,
+		"[xa]\n[]\n[cy]\n",
+	},
+	{
+		`a=(); for e in "${a[@]}"; do echo "[$e]"; done; for e in "$@"; do echo x; done`,
+		"",
+	},
+	{
+		"a=(b c d); echo ${#a[@]} ${#a[*]} ${#a[1]} ${!a[@]}",
+		"3 3 1 0 1 2\n",
+	},
+	{
+		"a=(b c d); echo ${a[-1]} ${a[-3]}; echo ${a[@]: -2}; echo ${a[@]:1:1}",
+		"d b\nc d\nc\n",
+	},
+	{
+		"a=(b c d); a[5]=x; unset a[1]; echo ${!a[@]}; echo ${#a[@]} ${a[@]}; echo ${a[-1]} ${a[@]:2}",
+		"0 2 5\n3 b d x\nx d x\n",
+	},
+	{
+		"a=([3]=x y [0]=z); a+=(w); echo ${!a[@]}; echo ${a[@]}",
+		"0 3 4 5\nz x y w\n",
+	},
+	{
+		"set -- a b c; echo ${@:2}; echo ${*:1:2}; echo ${@: -1}; echo ${#@}",
+		"b c\na b\nc\n3\n",
+	},
+	{
+		`pre_b=1 pre_a=2 pre=3; for e in "${!pre_@}"; do echo $e; done; echo "${!pre*}"`,
+		"pre_a\npre_b\npre pre_a pre_b\n",
+	},
+	{
+		`a=(ab bb c); echo ${a[@]^^}; echo ${a[@]#?}; echo ${a[*]/b/x}`,
+		"AB BB C\nb b\nax xb c\n",
+	},
+	{
+		`a=(); echo ${a[@]:-x}; a=(''); echo ${a[@]:-y}; a=(b c); echo ${a[@]:-z} ${a[@]:+w}`,
+		"x\ny\nb c w\n",
+	},
+	{
+		`for x in "${nope[@]}"; do echo $x; done; f() { echo $#; }; f "${nope[@]}"`,
+		"0\n",
+	},
+	{
+		"a[3]=x; echo ${!a[@]}; arr+=(one); echo ${#arr[@]} ${!arr[@]}",
+		"3\n1 0\n",
+	},
+	{
+		"a=(b c d); i=0; unset 'a[i+1]'; echo ${!a[@]} ${a[@]}",
+		"0 2 b d\n",
+	},
+	{
+		"a=(1 2 3); set -- x; echo ${a[@]: -5}-${@: -3}-${@: -1}",
+		"--x\n",
+	},
+	{
+		"a=(1 2 3); echo ${a[@]:1:-1}; echo next $?",
+		"-1: substring expression < 0\nnext 1\n #IGNORE",
+	},
+	{
+		"f() { echo ${a[@]:1:-1}; echo same; }; a=(1 2 3); f; echo next $?",
+		"-1: substring expression < 0\nnext 1\n #IGNORE",
+	},
+	{
+		`a=(1 2); b="${a[@]}"; echo "$b"; set -- x y; c=$@; echo "$c"`,
+		"1 2\nx y\n",
+	},
 
 	// declare
 	{
@@ -1104,6 +1432,85 @@ func TestFile(t *testing.T) {
 	}
 }
 
+// readerCases are run with RunReader, as they depend on each line
+// being parsed after the previous ones have run.
+var readerCases = []struct {
+	in, want string
+}{
+	{
+		"shopt -s expand_aliases\nalias ll='echo ll' e='echo ' x=foo\nll a; e x; \\ll 2>/dev/null; 'll'; echo $?",
+		"ll a\nfoo\nll: command not found\n127\n #IGNORE",
+	},
+	{
+		"shopt -s expand_aliases\nalias ls='ls -d'\nls /",
+		"/\n",
+	},
+	{
+		"shopt -s expand_aliases\nalias a=b b=a\na; echo $?",
+		"a: command not found\n127\n #IGNORE",
+	},
+	{
+		"shopt -s expand_aliases\nalias q='echo q; echo r'\nq",
+		"q\nr\n",
+	},
+	{
+		"shopt -s expand_aliases; alias ll='echo hi'; ll; echo $?",
+		"ll: command not found\n127\n #IGNORE",
+	},
+	{
+		"shopt -s expand_aliases\nalias ll='echo hi'\nf() { ll; }\nunalias ll\nf; ll; echo $?",
+		"hi\nll: command not found\n127\n #IGNORE",
+	},
+	{
+		"shopt -s expand_aliases\nalias beg='if true; then' l='echo a |'\nbeg echo x; fi\nl cat",
+		"x\na\n",
+	},
+	{
+		"shopt -s expand_aliases\nalias e='echo ' x='foo '\ne x x x",
+		"foo foo foo\n",
+	},
+}
+
+func TestRunReader(t *testing.T) {
+	for i, c := range readerCases {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			var cb concBuffer
+			r := Runner{
+				Stdout: &cb,
+				Stderr: &cb,
+			}
+			if err := r.RunReader(strings.NewReader(c.in), ""); err != nil {
+				cb.WriteString(err.Error())
+			}
+			want := c.want
+			if i := strings.Index(want, " #IGNORE"); i >= 0 {
+				want = want[:i]
+			}
+			if got := cb.String(); got != want {
+				t.Fatalf("wrong output in %q:\nwant: %q\ngot:  %q",
+					c.in, want, got)
+			}
+		})
+	}
+}
+
+func TestRunReaderParseError(t *testing.T) {
+	var cb concBuffer
+	r := Runner{
+		Stdout: &cb,
+		Stderr: &cb,
+	}
+	err := r.RunReader(strings.NewReader("echo foo\necho bar; fi\necho baz"), "f.sh")
+	want := `f.sh:2:11: "fi" can only be used to end an if`
+	if err == nil || err.Error() != want {
+		t.Fatalf("wrong error:\nwant: %s\ngot:  %v", want, err)
+	}
+	// like in shells, the lines before the error were run
+	if got := cb.String(); got != "foo\n" {
+		t.Fatalf("wrong output: %q", got)
+	}
+}
+
 func TestFileConfirm(t *testing.T) {
 	if testing.Short() {
 		t.Skip("calling bash is slow.")
@@ -1173,6 +1580,46 @@ func TestRunnerOpts(t *testing.T) {
 			"env | grep '^a=' | tail -n 1; echo $a",
 			"a=c\nc\n",
 		},
+		{
+			Runner{Env: []string{"HOME=/h"}},
+			"echo ~ $HOME; a=~/x; echo $a",
+			"/h /h\n/h/x\n",
+		},
+		{
+			Runner{Variant: syntax.LangPOSIX},
+			"echo a{b,c} {1..2}",
+			"a{b,c} {1..2}\n",
+		},
+		{
+			Runner{Variant: syntax.LangPOSIX},
+			`echo 'a\nb'`,
+			"a\nb\n",
+		},
+		{
+			Runner{Translate: func(domain, msg string) string {
+				if msg == "hello $a" {
+					return domain + ": hola $a"
+				}
+				return msg
+			}},
+			`a=world TEXTDOMAIN=app; echo $"hello $a" $"bye $a" "hello $a"`,
+			"app: hola world bye world hello world\n",
+		},
+		{
+			Runner{Builtins: map[string]BuiltinFunc{
+				"greet": func(bc *BuiltinContext, args []string) int {
+					fmt.Fprintf(bc.Stdout, "hi %s from %s\n", args[0], bc.Getenv("who"))
+					bc.Setenv("greeted", "yes")
+					return 3
+				},
+				"cat": func(bc *BuiltinContext, args []string) int {
+					fmt.Fprintln(bc.Stderr, "not cat")
+					return 0
+				},
+			}},
+			"who=me; greet you; echo $? $greeted; type greet; builtin greet x >/dev/null; echo $?; cat; greet() { echo fn; }; greet",
+			"hi you from me\n3 yes\ngreet is a shell builtin\n3\nnot cat\nfn\n",
+		},
 		{
 			Runner{Env: []string{"foo"}},
 			"",
@@ -1243,3 +1690,74 @@ func TestRunnerContext(t *testing.T) {
 		})
 	}
 }
+
+func TestRunnerProcessGroups(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for programs to be killed")
+	}
+	cases := []string{
+		"sh -c 'sleep 1000 & wait'",
+		// SIGTERM is ignored, so SIGKILL must follow
+		`sh -c 'trap "" TERM; sleep 1000 & wait'`,
+	}
+	p := syntax.NewParser()
+	for i, in := range cases {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			file, err := p.Parse(strings.NewReader(in), "")
+			if err != nil {
+				t.Fatalf("could not parse: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// the orphaned sleep keeps the output pipe open
+			var cb concBuffer
+			r := Runner{
+				File:          file,
+				Context:       ctx,
+				Stdout:        &cb,
+				Stderr:        &cb,
+				ProcessGroups: true,
+				KillTimeout:   50 * time.Millisecond,
+			}
+			errChan := make(chan error)
+			go func() {
+				errChan <- r.Run()
+			}()
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+
+			select {
+			case err := <-errChan:
+				if err != ctx.Err() {
+					t.Fatalf("Runner did not use ctx.Err(): %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("program group was not killed in 1s")
+			}
+		})
+	}
+}
+
+func TestRunnerUmask(t *testing.T) {
+	orig := processUmask()
+	for _, mask := range []os.FileMode{0077, orig} {
+		t.Run(fmt.Sprintf("%04o", mask), func(t *testing.T) {
+			in := fmt.Sprintf("umask %04o; sh -c umask", mask)
+			file, err := syntax.NewParser().Parse(strings.NewReader(in), "")
+			if err != nil {
+				t.Fatalf("could not parse: %v", err)
+			}
+			var cb concBuffer
+			r := Runner{File: file, Stdout: &cb, Stderr: &cb}
+			if err := r.Run(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, want := cb.String(), fmt.Sprintf("%04o\n", mask); got != want {
+				t.Fatalf("child got umask %q, want %q", got, want)
+			}
+			if got := setUmask(orig); got != orig {
+				t.Fatalf("process umask left as %04o, want %04o", got, orig)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultPath is the PATH used by command -p and when PATH is unset,
+// which is guaranteed to find the standard utilities.
+const defaultPath = "/bin:/usr/bin"
+
+// pathList returns the value of PATH, or the default PATH if unset.
+func (r *Runner) pathList() string {
+	if val, ok := r.lookupVar("PATH"); ok {
+		return varStr(val)
+	}
+	return defaultPath
+}
+
+func isKeyword(name string) bool {
+	switch name {
+	case "if", "then", "else", "elif", "fi", "case", "esac", "for",
+		"select", "while", "until", "do", "done", "in", "function",
+		"time", "{", "}", "!", "[[", "]]", "coproc":
+		return true
+	}
+	return false
+}
+
+// hashTable remembers the paths of the programs found via PATH, like
+// the hash builtin. Subshells get their own table via fork, which may
+// run concurrently with the parent, so it is safe for concurrent use.
+type hashTable struct {
+	mu      sync.Mutex
+	entries map[string]*hashEntry
+
+	// shared is set when entries may also be used by another table,
+	// in which case it must be copied before being modified.
+	shared bool
+}
+
+type hashEntry struct {
+	path string
+	hits int
+}
+
+// fork returns a copy of the table for a subshell. The entries are
+// only copied once either table is modified.
+func (h *hashTable) fork() *hashTable {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shared = true
+	return &hashTable{entries: h.entries, shared: true}
+}
+
+// own makes sure that the entries are not shared with another table,
+// so that they can be modified. h.mu must be held.
+func (h *hashTable) own() {
+	if !h.shared {
+		return
+	}
+	h.shared = false
+	if h.entries == nil {
+		return
+	}
+	entries := make(map[string]*hashEntry, len(h.entries))
+	for name, e := range h.entries {
+		e2 := *e
+		entries[name] = &e2
+	}
+	h.entries = entries
+}
+
+// lookup returns the remembered path for a name, counting it as a hit.
+func (h *hashTable) lookup(name string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.own()
+	e := h.entries[name]
+	if e == nil {
+		return "", false
+	}
+	e.hits++
+	return e.path, true
+}
+
+// get returns the remembered path for a name, without counting it as
+// a hit.
+func (h *hashTable) get(name string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e := h.entries[name]; e != nil {
+		return e.path, true
+	}
+	return "", false
+}
+
+func (h *hashTable) add(name, path string, hits int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.own()
+	if h.entries == nil {
+		h.entries = make(map[string]*hashEntry, 4)
+	}
+	h.entries[name] = &hashEntry{path: path, hits: hits}
+}
+
+// remove forgets a name, reporting whether it was remembered.
+func (h *hashTable) remove(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.own()
+	_, ok := h.entries[name]
+	delete(h.entries, name)
+	return ok
+}
+
+func (h *hashTable) reset() {
+	h.mu.Lock()
+	h.entries = nil
+	h.shared = false
+	h.mu.Unlock()
+}
+
+// list returns the remembered names, sorted, along with their entries.
+func (h *hashTable) list() ([]string, []hashEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.entries))
+	for name := range h.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]hashEntry, len(names))
+	for i, name := range names {
+		entries[i] = *h.entries[name]
+	}
+	return names, entries
+}
+
+// isExecutable reports whether a path is a regular file that can be
+// executed.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// findExecutables returns the paths to the executables that a command
+// name refers to, searching a PATH list if the name contains no
+// slashes. Like in shells, relative PATH entries give relative paths,
+// which are resolved against the current directory. Only the first
+// path is returned unless all is true.
+func (r *Runner) findExecutables(name, pathList string, all bool) []string {
+	if strings.Contains(name, "/") {
+		if isExecutable(r.absPath(name)) {
+			return []string{name}
+		}
+		return nil
+	}
+	var paths []string
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			dir = "."
+		}
+		path := filepath.Join(dir, name)
+		if isExecutable(r.absPath(path)) {
+			paths = append(paths, path)
+			if !all {
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// lookPath returns the path to the executable that a command name
+// refers to, using and updating the hash table. Like in bash, the
+// hash table is not used if PATH is only set for the command, as in
+// "PATH=/bin cmd".
+func (r *Runner) lookPath(name string) (string, bool) {
+	_, tempPath := r.cmdVars["PATH"]
+	hashable := !tempPath && !strings.Contains(name, "/")
+	if hashable {
+		if path, ok := r.hashes.lookup(name); ok && isExecutable(r.absPath(path)) {
+			return path, true
+		}
+	}
+	paths := r.findExecutables(name, r.pathList(), false)
+	if len(paths) == 0 {
+		return "", false
+	}
+	if hashable {
+		r.hashes.add(name, paths[0], 1)
+	}
+	return paths[0], true
+}
+
+// A cmdKind is one of the things that a command name can refer to, as
+// reported by the type builtin.
+type cmdKind struct {
+	kind string // "alias", "keyword", "function", "builtin" or "file"
+
+	// the alias value, or the path to the executable
+	value  string
+	hashed bool
+}
+
+// cmdKinds returns what a command name refers to, in order of
+// precedence, searching for programs in pathList. Only the first one
+// is returned unless all is true.
+func (r *Runner) cmdKinds(name, pathList string, all bool) []cmdKind {
+	var kinds []cmdKind
+	add := func(k cmdKind) bool {
+		kinds = append(kinds, k)
+		return !all
+	}
+	if val, ok := r.aliases[name]; ok && r.shopts[optExpandAliases] {
+		if add(cmdKind{kind: "alias", value: val}) {
+			return kinds
+		}
+	}
+	if isKeyword(name) {
+		if add(cmdKind{kind: "keyword"}) {
+			return kinds
+		}
+	}
+	if _, ok := r.funcs[name]; ok {
+		if add(cmdKind{kind: "function"}) {
+			return kinds
+		}
+	}
+	if r.isBuiltin(name) {
+		if add(cmdKind{kind: "builtin"}) {
+			return kinds
+		}
+	}
+	if !all && pathList == r.pathList() && !strings.Contains(name, "/") {
+		if path, ok := r.hashes.get(name); ok {
+			return append(kinds, cmdKind{kind: "file", value: path, hashed: true})
+		}
+	}
+	for _, path := range r.findExecutables(name, pathList, all) {
+		kinds = append(kinds, cmdKind{kind: "file", value: path})
+	}
+	return kinds
+}
+
+// describe returns how the type builtin describes what a command name
+// refers to.
+func describe(name string, k cmdKind) string {
+	switch k.kind {
+	case "alias":
+		return name + " is aliased to `" + k.value + "'"
+	case "keyword":
+		return name + " is a shell keyword"
+	case "function":
+		return name + " is a function"
+	case "builtin":
+		return name + " is a shell builtin"
+	}
+	if k.hashed {
+		return name + " is hashed (" + k.value + ")"
+	}
+	return name + " is " + k.value
+}
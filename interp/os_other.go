@@ -0,0 +1,27 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+//go:build windows
+// +build windows
+
+package interp
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setUmask is a no-op, as the system has no umask.
+func setUmask(mask os.FileMode) os.FileMode {
+	return 0
+}
+
+// setProcGroup is a no-op, as the system has no process groups.
+func setProcGroup(cmd *exec.Cmd) {}
+
+// signalCmd kills a started command, as the system cannot send it
+// any other signals.
+func signalCmd(cmd *exec.Cmd, sig syscall.Signal, group bool) error {
+	return cmd.Process.Kill()
+}
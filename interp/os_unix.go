@@ -0,0 +1,32 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+//go:build !windows
+// +build !windows
+
+package interp
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setUmask(mask os.FileMode) os.FileMode {
+	return os.FileMode(syscall.Umask(int(mask)))
+}
+
+// setProcGroup makes a command start in its own process group, so
+// that it can be signalled along with all of its descendants.
+func setProcGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalCmd sends a signal to a started command, or to its entire
+// process group if group is true.
+func signalCmd(cmd *exec.Cmd, sig syscall.Signal, group bool) error {
+	if group {
+		return syscall.Kill(-cmd.Process.Pid, sig)
+	}
+	return cmd.Process.Signal(sig)
+}
@@ -4,59 +4,165 @@
 package interp
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/mvdan/sh/syntax"
 )
 
-func (r *Runner) quotedElems(pe *syntax.ParamExp) []string {
-	if pe == nil {
-		return nil
-	}
-	if pe.Param.Value == "@" {
-		return r.args
+// allElems returns "@" or "*" if the parameter expansion is over all
+// the elements of an array, like ${a[@]} or $*. Otherwise, it returns
+// the empty string.
+func allElems(pe *syntax.ParamExp) string {
+	switch pe.Param.Value {
+	case "@", "*":
+		return pe.Param.Value
 	}
 	w, _ := pe.Index.(*syntax.Word)
 	if w == nil || len(w.Parts) != 1 {
-		return nil
+		return ""
 	}
 	l, _ := w.Parts[0].(*syntax.Lit)
-	if l == nil || l.Value != "@" {
-		return nil
+	if l == nil {
+		return ""
 	}
-	val, _ := r.lookupVar(pe.Param.Value)
-	switch x := val.(type) {
-	case []string:
-		return x
+	switch l.Value {
+	case "@", "*":
+		return l.Value
 	}
-	return nil
+	return ""
 }
 
+// paramExp expands a parameter expansion into a single string, joining
+// multiple elements with spaces.
 func (r *Runner) paramExp(pe *syntax.ParamExp) string {
+	elems, _ := r.paramElems(pe)
+	return strings.Join(elems, " ")
+}
+
+// paramElems expands a parameter expansion into its elements. The
+// boolean result reports whether the elements should be separate
+// fields when quoted, like in "$@" or "${a[@]}", as opposed to being
+// joined.
+func (r *Runner) paramElems(pe *syntax.ParamExp) ([]string, bool) {
 	name := pe.Param.Value
+	if pe.Exp != nil && pe.Exp.Op == syntax.OtherParamOps && pe.Exp.Word == nil {
+		// the parser reads ${!prefix@} and ${#@} as an @ operator
+		// without an argument
+		switch {
+		case pe.Indirect:
+			return r.varNames(name), true
+		case name == "#":
+			return []string{strconv.Itoa(len(r.args))}, false
+		}
+	}
+	if pe.Indirect && pe.Index == nil && len(name) > 1 {
+		switch last := name[len(name)-1]; last {
+		case '@', '*':
+			// ${!prefix@} and ${!prefix*}
+			return r.varNames(name[:len(name)-1]), last == '@'
+		}
+	}
 	var val varValue
 	set := false
 	switch name {
 	case "#":
-		val = strconv.Itoa(len(r.args))
-	case "*", "@":
-		val = strings.Join(r.args, " ")
+		val, set = strconv.Itoa(len(r.args)), true
+	case "@", "*":
+		// positional parameters start at index 1
+		arr := make(indexArray, len(r.args))
+		for i, arg := range r.args {
+			arr[i+1] = arg
+		}
+		val, set = arr, true
 	case "?":
-		val = strconv.Itoa(r.exit)
+		val, set = strconv.Itoa(r.exit), true
+	case "0":
+		val, set = r.shellName(), true
 	default:
 		if n, err := strconv.Atoi(name); err == nil {
-			if i := n - 1; i < len(r.args) {
+			if i := n - 1; i >= 0 && i < len(r.args) {
 				val, set = r.args[i], true
 			}
 		} else {
 			val, set = r.lookupVar(name)
 		}
 	}
+	all := allElems(pe)
+	if pe.Exp != nil && pe.Exp.Op == syntax.OtherParamOps {
+		// operators that work on the variable as a whole
+		switch r.loneWord(pe.Exp.Word) {
+		case "A":
+			if !set {
+				return nil, false
+			}
+			return []string{r.varDecl(name, val)}, false
+		case "a":
+			if !set {
+				return nil, false
+			}
+			if all == "" {
+				return []string{r.varAttrs(name, val)}, false
+			}
+			elems := r.arrayElems(pe, val)
+			for i := range elems {
+				elems[i] = r.varAttrs(name, val)
+			}
+			return elems, all == "@"
+		case "K", "k":
+			if all == "" {
+				break
+			}
+			pairs := r.keyValuePairs(val)
+			if r.loneWord(pe.Exp.Word) == "k" {
+				return pairs, all == "@"
+			}
+			var buf bytes.Buffer
+			for i := 0; i < len(pairs); i += 2 {
+				if i > 0 {
+					buf.WriteByte(' ')
+				}
+				fmt.Fprintf(&buf, "%s %s", pairs[i], dblQuote(pairs[i+1]))
+			}
+			if _, ok := val.(assocArray); ok && len(pairs) > 0 {
+				// bash adds a trailing space for associative arrays
+				buf.WriteByte(' ')
+			}
+			return []string{buf.String()}, false
+		}
+	}
+	if all != "" {
+		elems := r.arrayElems(pe, val)
+		if pe.Length || pe.Indirect {
+			// ${#a[@]} and ${!a[@]} were already handled
+			return elems, all == "@" && pe.Indirect
+		}
+		if pe.Exp != nil && isSubstOp(pe.Exp.Op) {
+			str := strings.Join(elems, " ")
+			if sub := r.paramSubst(pe, name, str, len(elems) > 0); sub != str {
+				return []string{sub}, false
+			}
+			return elems, all == "@"
+		}
+		for i, elem := range elems {
+			elems[i] = r.paramOps(pe, elem)
+		}
+		return elems, all == "@"
+	}
 	str := varStr(val)
-	if pe.Index != nil {
+	if pe.Key != nil {
+		if m, ok := val.(assocArray); ok {
+			str = m[r.assocKey(nil, pe.Key)]
+		}
+	} else if pe.Index != nil {
 		str = r.varInd(val, pe.Index)
 	}
 	switch {
@@ -88,6 +194,213 @@ func (r *Runner) paramExp(pe *syntax.ParamExp) string {
 			str = str[:length]
 		}
 	}
+	if pe.Exp != nil && isSubstOp(pe.Exp.Op) {
+		return []string{r.paramSubst(pe, name, str, set)}, false
+	}
+	return []string{r.paramOps(pe, str)}, false
+}
+
+// arrayElems returns the elements of an array that a parameter
+// expansion over all of its elements refers to. This takes care of
+// lengths like ${#a[@]}, keys like ${!a[@]} and slices like
+// ${a[@]:1:2}.
+func (r *Runner) arrayElems(pe *syntax.ParamExp, val varValue) []string {
+	var keys, vals []string
+	if m, ok := val.(assocArray); ok {
+		keys = m.keys()
+		for _, k := range keys {
+			vals = append(vals, m[k])
+		}
+		if pe.Slice != nil {
+			// slices work on the list of values
+			offset := 0
+			if pe.Slice.Offset != nil {
+				offset = r.arithm(pe.Slice.Offset)
+				if offset < 0 {
+					offset += len(keys)
+				}
+				if offset < 0 || offset > len(keys) {
+					offset = len(keys)
+				}
+			}
+			keys, vals = keys[offset:], vals[offset:]
+		}
+	} else {
+		arr := toIndexArray(val)
+		indices := arr.keys()
+		if pe.Slice != nil && pe.Slice.Offset != nil {
+			// slices work on indices, which matters for
+			// sparse arrays
+			offset := r.arithm(pe.Slice.Offset)
+			if offset < 0 {
+				offset += arr.next()
+				if offset < 0 {
+					// out of range, like ${a[@]: -5}
+					// with fewer elements
+					indices = nil
+				}
+			}
+			i := 0
+			for i < len(indices) && indices[i] < offset {
+				i++
+			}
+			indices = indices[i:]
+		}
+		for _, i := range indices {
+			keys = append(keys, strconv.Itoa(i))
+			vals = append(vals, arr[i])
+		}
+	}
+	if pe.Slice != nil && pe.Slice.Length != nil {
+		length := r.arithm(pe.Slice.Length)
+		if length < 0 {
+			r.errf("%d: substring expression < 0\n", length)
+			r.err = errExpansion
+			return nil
+		}
+		if length < len(keys) {
+			keys, vals = keys[:length], vals[:length]
+		}
+	}
+	switch {
+	case pe.Length:
+		return []string{strconv.Itoa(len(keys))}
+	case pe.Indirect:
+		return keys
+	}
+	return vals
+}
+
+// keyValuePairs returns the keys and values of an array, alternating
+// between them, like ${a[@]@k}. Keys are in the same order as in
+// ${!a[@]}.
+func (r *Runner) keyValuePairs(val varValue) []string {
+	var pairs []string
+	switch x := val.(type) {
+	case assocArray:
+		for _, k := range x.keys() {
+			pairs = append(pairs, k, x[k])
+		}
+	default:
+		arr := toIndexArray(val)
+		for _, i := range arr.keys() {
+			pairs = append(pairs, strconv.Itoa(i), arr[i])
+		}
+	}
+	return pairs
+}
+
+// varAttrs returns the attribute flags of a variable, like ${a@a}.
+func (r *Runner) varAttrs(name string, val varValue) string {
+	var attrs string
+	switch val.(type) {
+	case indexArray:
+		attrs = "a"
+	case assocArray:
+		attrs = "A"
+	}
+	if _, ok := r.envMap[name]; ok {
+		attrs += "x"
+	}
+	return attrs
+}
+
+// varDecl returns a statement that would declare the variable with its
+// current value and attributes, like ${a@A}.
+func (r *Runner) varDecl(name string, val varValue) string {
+	attrs := r.varAttrs(name, val)
+	var buf bytes.Buffer
+	if attrs != "" {
+		fmt.Fprintf(&buf, "declare -%s ", attrs)
+	}
+	buf.WriteString(name)
+	switch x := val.(type) {
+	case indexArray:
+		buf.WriteString("=(")
+		for i, k := range x.keys() {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			fmt.Fprintf(&buf, "[%d]=%s", k, dblQuote(x[k]))
+		}
+		buf.WriteByte(')')
+	case assocArray:
+		if len(x) == 0 {
+			break
+		}
+		buf.WriteString("=(")
+		for _, k := range x.keys() {
+			fmt.Fprintf(&buf, "[%s]=%s ", k, dblQuote(x[k]))
+		}
+		buf.WriteByte(')')
+	default:
+		fmt.Fprintf(&buf, "=%s", shellQuote(varStr(val)))
+	}
+	return buf.String()
+}
+
+func isSubstOp(op syntax.ParExpOperator) bool {
+	switch op {
+	case syntax.SubstPlus, syntax.SubstColPlus,
+		syntax.SubstMinus, syntax.SubstColMinus,
+		syntax.SubstQuest, syntax.SubstColQuest,
+		syntax.SubstAssgn, syntax.SubstColAssgn:
+		return true
+	}
+	return false
+}
+
+// paramSubst applies the default value operators such as ${a:-b},
+// given whether the parameter is set and its value.
+func (r *Runner) paramSubst(pe *syntax.ParamExp, name, str string, set bool) string {
+	arg := r.loneWord(pe.Exp.Word)
+	switch pe.Exp.Op {
+	case syntax.SubstColPlus:
+		if str == "" {
+			break
+		}
+		fallthrough
+	case syntax.SubstPlus:
+		if set {
+			str = arg
+		}
+	case syntax.SubstMinus:
+		if set {
+			break
+		}
+		fallthrough
+	case syntax.SubstColMinus:
+		if str == "" {
+			str = arg
+		}
+	case syntax.SubstQuest:
+		if set {
+			break
+		}
+		fallthrough
+	case syntax.SubstColQuest:
+		if str == "" {
+			r.errf("%s", arg)
+			r.exit = 1
+			r.lastExit()
+		}
+	case syntax.SubstAssgn:
+		if set {
+			break
+		}
+		fallthrough
+	case syntax.SubstColAssgn:
+		if str == "" {
+			r.setVar(name, arg)
+			str = arg
+		}
+	}
+	return str
+}
+
+// paramOps applies the string manipulation operators of a parameter
+// expansion, such as ${a/b/c} or ${a^^}, to a single value.
+func (r *Runner) paramOps(pe *syntax.ParamExp, str string) string {
 	if pe.Repl != nil {
 		orig := r.loneWord(pe.Repl.Orig)
 		with := r.loneWord(pe.Repl.With)
@@ -97,93 +410,238 @@ func (r *Runner) paramExp(pe *syntax.ParamExp) string {
 		}
 		str = strings.Replace(str, orig, with, n)
 	}
-	if pe.Exp != nil {
-		arg := r.loneWord(pe.Exp.Word)
-		switch pe.Exp.Op {
-		case syntax.SubstColPlus:
-			if str == "" {
-				break
-			}
-			fallthrough
-		case syntax.SubstPlus:
-			if set {
-				str = arg
+	if pe.Exp == nil {
+		return str
+	}
+	arg := r.loneWord(pe.Exp.Word)
+	switch pe.Exp.Op {
+	case syntax.RemSmallPrefix:
+		str = removePattern(str, arg, false, false)
+	case syntax.RemLargePrefix:
+		str = removePattern(str, arg, false, true)
+	case syntax.RemSmallSuffix:
+		str = removePattern(str, arg, true, false)
+	case syntax.RemLargeSuffix:
+		str = removePattern(str, arg, true, true)
+	case syntax.UpperFirst:
+		rs := []rune(str)
+		if len(rs) > 0 {
+			rs[0] = unicode.ToUpper(rs[0])
+		}
+		str = string(rs)
+	case syntax.UpperAll:
+		str = strings.ToUpper(str)
+	case syntax.LowerFirst:
+		rs := []rune(str)
+		if len(rs) > 0 {
+			rs[0] = unicode.ToLower(rs[0])
+		}
+		str = string(rs)
+	case syntax.LowerAll:
+		str = strings.ToLower(str)
+	case syntax.OtherParamOps:
+		switch arg {
+		case "Q", "K", "k":
+			str = shellQuote(str)
+		case "E":
+			str = ansiCString(str)
+		case "P":
+			str = r.expandPrompt(str)
+		default:
+			r.runErr(pe.Pos(), "unexpected @%s param expansion", arg)
+		}
+	}
+	return str
+}
+
+// expandPrompt expands the backslash escape sequences of a prompt
+// string, like ${a@P} or PS1. As there is no job control nor history,
+// \j, \! and \# are not supported, and neither are \v and \V.
+func (r *Runner) expandPrompt(s string) string {
+	var buf bytes.Buffer
+	now := time.Now()
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'a':
+			buf.WriteByte('\a')
+		case 'e':
+			buf.WriteByte('\x1b')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'd':
+			buf.WriteString(now.Format("Mon Jan 02"))
+		case 't':
+			buf.WriteString(now.Format("15:04:05"))
+		case 'T':
+			buf.WriteString(now.Format("03:04:05"))
+		case '@':
+			buf.WriteString(now.Format("03:04 PM"))
+		case 'A':
+			buf.WriteString(now.Format("15:04"))
+		case 'D':
+			end := -1
+			if i+1 < len(s) && s[i+1] == '{' {
+				end = strings.IndexByte(s[i+1:], '}')
 			}
-		case syntax.SubstMinus:
-			if set {
+			if end < 0 {
+				buf.WriteString("\\D")
 				break
 			}
-			fallthrough
-		case syntax.SubstColMinus:
-			if str == "" {
-				str = arg
+			format := s[i+2 : i+1+end]
+			if format == "" {
+				format = "%X"
 			}
-		case syntax.SubstQuest:
-			if set {
-				break
-			}
-			fallthrough
-		case syntax.SubstColQuest:
-			if str == "" {
-				r.errf("%s", arg)
-				r.exit = 1
-				r.lastExit()
+			buf.WriteString(strftime(now, format))
+			i += end + 1
+		case 's':
+			buf.WriteString(filepath.Base(r.shellName()))
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if c == 'h' {
+				if i := strings.IndexByte(host, '.'); i >= 0 {
+					host = host[:i]
+				}
 			}
-		case syntax.SubstAssgn:
-			if set {
-				break
+			buf.WriteString(host)
+		case 'u':
+			name := r.getVar("USER")
+			if name == "" {
+				if u, err := user.Current(); err == nil {
+					name = u.Username
+				}
 			}
-			fallthrough
-		case syntax.SubstColAssgn:
-			if str == "" {
-				r.setVar(name, arg)
-				str = arg
-			}
-		case syntax.RemSmallPrefix:
-			str = removePattern(str, arg, false, false)
-		case syntax.RemLargePrefix:
-			str = removePattern(str, arg, false, true)
-		case syntax.RemSmallSuffix:
-			str = removePattern(str, arg, true, false)
-		case syntax.RemLargeSuffix:
-			str = removePattern(str, arg, true, true)
-		case syntax.UpperFirst:
-			rs := []rune(str)
-			if len(rs) > 0 {
-				rs[0] = unicode.ToUpper(rs[0])
-			}
-			str = string(rs)
-		case syntax.UpperAll:
-			str = strings.ToUpper(str)
-		case syntax.LowerFirst:
-			rs := []rune(str)
-			if len(rs) > 0 {
-				rs[0] = unicode.ToLower(rs[0])
-			}
-			str = string(rs)
-		case syntax.LowerAll:
-			str = strings.ToLower(str)
-		case syntax.OtherParamOps:
-			switch arg {
-			case "Q":
-				str = strconv.Quote(str)
-			case "E":
-				tail := str
-				var rns []rune
-				for tail != "" {
-					var rn rune
-					rn, _, tail, _ = strconv.UnquoteChar(tail, 0)
-					rns = append(rns, rn)
+			buf.WriteString(name)
+		case 'w', 'W':
+			dir := r.getVar("PWD")
+			home := r.getVar("HOME")
+			switch {
+			case home != "" && dir == home:
+				dir = "~"
+			case c == 'W':
+				if dir != "/" {
+					dir = filepath.Base(dir)
 				}
-				str = string(rns)
-			case "P", "A", "a":
-				r.runErr(pe.Pos(), "unhandled @%s param expansion", arg)
-			default:
-				r.runErr(pe.Pos(), "unexpected @%s param expansion", arg)
+			case home != "" && strings.HasPrefix(dir, home+"/"):
+				dir = "~" + dir[len(home):]
 			}
+			buf.WriteString(dir)
+		case '$':
+			if os.Geteuid() == 0 {
+				buf.WriteByte('#')
+			} else {
+				buf.WriteByte('$')
+			}
+		case '[', ']':
+			// non-printing sequence markers; nothing to print
+		case '\\':
+			buf.WriteByte('\\')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n, l := readDigits(s[i:], 8, 3)
+			buf.WriteByte(byte(n))
+			i += l - 1
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
 		}
 	}
-	return str
+	return buf.String()
+}
+
+// strftime formats a time like the C function of the same name, for
+// the conversions that are not specific to a locale. Unknown
+// conversions are left as they are.
+func strftime(t time.Time, format string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 >= len(format) {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = format[i]; c {
+		case 'a':
+			buf.WriteString(t.Format("Mon"))
+		case 'A':
+			buf.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			buf.WriteString(t.Format("Jan"))
+		case 'B':
+			buf.WriteString(t.Format("January"))
+		case 'c':
+			buf.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&buf, "%02d", t.Year()/100)
+		case 'd':
+			buf.WriteString(t.Format("02"))
+		case 'D', 'x':
+			buf.WriteString(t.Format("01/02/06"))
+		case 'e':
+			buf.WriteString(t.Format("_2"))
+		case 'F':
+			buf.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			buf.WriteString(t.Format("15"))
+		case 'I':
+			buf.WriteString(t.Format("03"))
+		case 'j':
+			fmt.Fprintf(&buf, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&buf, "%2d", t.Hour())
+		case 'l':
+			buf.WriteString(t.Format("_3"))
+		case 'm':
+			buf.WriteString(t.Format("01"))
+		case 'M':
+			buf.WriteString(t.Format("04"))
+		case 'n':
+			buf.WriteByte('\n')
+		case 'p':
+			buf.WriteString(t.Format("PM"))
+		case 'r':
+			buf.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			buf.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&buf, "%d", t.Unix())
+		case 'S':
+			buf.WriteString(t.Format("05"))
+		case 't':
+			buf.WriteByte('\t')
+		case 'T', 'X':
+			buf.WriteString(t.Format("15:04:05"))
+		case 'u':
+			wd := int(t.Weekday())
+			if wd == 0 {
+				wd = 7
+			}
+			fmt.Fprintf(&buf, "%d", wd)
+		case 'w':
+			fmt.Fprintf(&buf, "%d", int(t.Weekday()))
+		case 'y':
+			buf.WriteString(t.Format("06"))
+		case 'Y':
+			buf.WriteString(t.Format("2006"))
+		case 'z':
+			buf.WriteString(t.Format("-0700"))
+		case 'Z':
+			buf.WriteString(t.Format("MST"))
+		case '%':
+			buf.WriteByte('%')
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
 }
 
 func removePattern(str, pattern string, fromEnd, longest bool) string {
@@ -218,3 +676,84 @@ func removePattern(str, pattern string, fromEnd, longest bool) string {
 	}
 	return last
 }
+
+// expandTilde expands a tilde prefix at the start of s, such as in
+// "~/bin" or "~user". whole is whether the tilde prefix may extend to
+// the end of s, which is not the case if s is followed by other word
+// parts like in ~"user".
+func (r *Runner) expandTilde(s string, whole bool) string {
+	if !strings.HasPrefix(s, "~") {
+		return s
+	}
+	name, rest := s[1:], ""
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name, rest = name[:i], name[i:]
+	} else if !whole {
+		return s
+	}
+	dir, ok := r.tildeDir(name)
+	if !ok {
+		return s
+	}
+	return dir + rest
+}
+
+// tildeDir returns the directory that a tilde prefix refers to, given
+// the characters that follow the tilde.
+func (r *Runner) tildeDir(name string) (string, bool) {
+	lookup := func(name string) (string, bool) {
+		val, ok := r.lookupVar(name)
+		return varStr(val), ok
+	}
+	switch name {
+	case "":
+		return lookup("HOME")
+	case "+":
+		return lookup("PWD")
+	case "-":
+		return lookup("OLDPWD")
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		// ~N, ~+N and ~-N refer to the directory stack
+		dirs := append([]string{r.Dir}, r.dirStack...)
+		if name[0] == '-' {
+			n = len(dirs) - 1 + n
+		}
+		if n < 0 || n >= len(dirs) {
+			return "", false
+		}
+		return dirs[n], true
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+// assignWord expands the value of an assignment. Unlike in other
+// words, tilde expansion also happens after each colon, like in
+// PATH=~/bin:~/sbin.
+func (r *Runner) assignWord(word *syntax.Word) string {
+	parts := make([]syntax.WordPart, len(word.Parts))
+	for i, wp := range word.Parts {
+		parts[i] = wp
+		lit, ok := wp.(*syntax.Lit)
+		if !ok {
+			continue
+		}
+		last := i == len(word.Parts)-1
+		strs := strings.Split(lit.Value, ":")
+		for j, str := range strs {
+			if j == 0 && i > 0 {
+				// not after a colon nor at the start
+				continue
+			}
+			strs[j] = r.expandTilde(str, last || j < len(strs)-1)
+		}
+		lit2 := *lit
+		lit2.Value = strings.Join(strs, ":")
+		parts[i] = &lit2
+	}
+	return r.loneParts(parts)
+}
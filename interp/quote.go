@@ -0,0 +1,277 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mvdan/sh/syntax"
+)
+
+// shellQuote quotes a string so that the parser reads it back as the
+// same value, like bash's ${a@Q}. Single quotes are used unless the
+// string contains non-printable characters, in which case it uses the
+// $'...' form.
+func shellQuote(s string) string {
+	printable := true
+	for _, r := range s {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	}
+	var buf bytes.Buffer
+	buf.WriteString("$'")
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&buf, "\\%03o", s[i])
+		case r == '\\', r == '\'':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\a':
+			buf.WriteString(`\a`)
+		case r == '\b':
+			buf.WriteString(`\b`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\v':
+			buf.WriteString(`\v`)
+		case r == '\x1b':
+			buf.WriteString(`\E`)
+		case r < utf8.RuneSelf && !unicode.IsPrint(r):
+			fmt.Fprintf(&buf, "\\%03o", r)
+		default:
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+// dblQuote quotes a string within double quotes, escaping the
+// characters that are special inside them.
+func dblQuote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '$', '`':
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// ansiCString evaluates the backslash escape sequences that bash
+// supports in $'...' strings, such as \n, \x1b or \u00e9. Unknown
+// escape sequences are left as-is.
+func ansiCString(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		c = s[i]
+		if b, ok := simpleEscape(c); ok {
+			buf.WriteByte(b)
+			continue
+		}
+		switch c {
+		case '\'', '"', '?':
+			buf.WriteByte(c)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n, l := readDigits(s[i:], 8, 3)
+			buf.WriteByte(byte(n))
+			i += l - 1
+		case 'x', 'u', 'U':
+			i += hexEscape(&buf, c, s[i+1:])
+		case 'c':
+			if i+1 < len(s) {
+				i++
+				buf.WriteByte(controlChar(s[i]))
+				break
+			}
+			fallthrough
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// echoEscapes evaluates the backslash escape sequences that echo -e
+// supports. Unlike in $'...' strings, octal sequences must start with
+// \0, and \c means that no further output should be produced, which
+// is reported via the boolean result.
+func echoEscapes(s string) (string, bool) {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		c = s[i]
+		if b, ok := simpleEscape(c); ok {
+			buf.WriteByte(b)
+			continue
+		}
+		switch c {
+		case 'c':
+			return buf.String(), true
+		case '0':
+			n, l := readDigits(s[i+1:], 8, 3)
+			buf.WriteByte(byte(n))
+			i += l
+		case 'x', 'u', 'U':
+			i += hexEscape(&buf, c, s[i+1:])
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), false
+}
+
+// simpleEscape returns the character that a single-letter escape
+// sequence like \n represents, if it is one.
+func simpleEscape(c byte) (byte, bool) {
+	switch c {
+	case 'a':
+		return '\a', true
+	case 'b':
+		return '\b', true
+	case 'e', 'E':
+		return '\x1b', true
+	case 'f':
+		return '\f', true
+	case 'n':
+		return '\n', true
+	case 'r':
+		return '\r', true
+	case 't':
+		return '\t', true
+	case 'v':
+		return '\v', true
+	case '\\':
+		return '\\', true
+	}
+	return 0, false
+}
+
+// hexEscape writes the character represented by a \xHH, \uHHHH or
+// \UHHHHHHHH escape sequence, given the letter and what follows it.
+// It returns how many hex digits were used.
+func hexEscape(buf *bytes.Buffer, c byte, s string) int {
+	max := 2
+	switch c {
+	case 'u':
+		max = 4
+	case 'U':
+		max = 8
+	}
+	n, l := readDigits(s, 16, max)
+	switch {
+	case l == 0:
+		buf.WriteByte('\\')
+		buf.WriteByte(c)
+	case c == 'x':
+		buf.WriteByte(byte(n))
+	default:
+		buf.WriteRune(rune(n))
+	}
+	return l
+}
+
+// controlChar returns the control character that \cX represents.
+func controlChar(c byte) byte {
+	if c == '?' {
+		return 0x7f
+	}
+	return c & 0x1f
+}
+
+// readDigits reads up to max digits in the given base from the start
+// of s, returning their value and how many bytes were read.
+func readDigits(s string, base, max int) (n, l int) {
+	for l < max && l < len(s) {
+		var d int
+		switch c := s[l]; {
+		case '0' <= c && c <= '9':
+			d = int(c - '0')
+		case 'a' <= c && c <= 'f':
+			d = int(c-'a') + 10
+		case 'A' <= c && c <= 'F':
+			d = int(c-'A') + 10
+		default:
+			return n, l
+		}
+		if d >= base {
+			return n, l
+		}
+		n = n*base + d
+		l++
+	}
+	return n, l
+}
+
+// translated returns the parts of a $"..." string after running its
+// source text through Translate, if set.
+func (r *Runner) translated(dq *syntax.DblQuoted) []syntax.WordPart {
+	if r.Translate == nil || len(dq.Parts) == 0 {
+		return dq.Parts
+	}
+	var buf bytes.Buffer
+	f := &syntax.File{Stmts: []*syntax.Stmt{{
+		Cmd: &syntax.CallExpr{Args: []*syntax.Word{{
+			Parts: []syntax.WordPart{&syntax.DblQuoted{Parts: dq.Parts}},
+		}}},
+	}}}
+	if err := syntax.NewPrinter().Print(&buf, f); err != nil {
+		return dq.Parts
+	}
+	msg := strings.TrimSuffix(buf.String(), "\n")
+	msg = msg[1 : len(msg)-1] // remove the quotes
+	trans := r.Translate(r.getVar("TEXTDOMAIN"), msg)
+	if trans == msg {
+		return dq.Parts
+	}
+	src := `"` + trans + `"`
+	f, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+	if err != nil || len(f.Stmts) != 1 {
+		return dq.Parts
+	}
+	call, _ := f.Stmts[0].Cmd.(*syntax.CallExpr)
+	if call == nil || len(call.Args) != 1 || len(call.Args[0].Parts) != 1 {
+		return dq.Parts
+	}
+	tdq, _ := call.Args[0].Parts[0].(*syntax.DblQuoted)
+	if tdq == nil {
+		return dq.Parts
+	}
+	return tdq.Parts
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// umaskMu guards the process umask, as child processes can only take
+// their umask from the process.
+var umaskMu sync.Mutex
+
+var (
+	umaskOnce sync.Once
+	umaskOrig os.FileMode
+)
+
+// processUmask returns the umask of the process. It is only read once,
+// as nothing else is expected to change it.
+func processUmask() os.FileMode {
+	umaskOnce.Do(func() {
+		umaskMu.Lock()
+		umaskOrig = setUmask(0)
+		setUmask(umaskOrig)
+		umaskMu.Unlock()
+	})
+	return umaskOrig
+}
+
+// withUmask calls fn with the process umask temporarily set to mask.
+// If mask is already the process umask, it is left alone.
+func withUmask(mask os.FileMode, fn func()) {
+	if mask == processUmask() {
+		fn()
+		return
+	}
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := setUmask(mask)
+	defer setUmask(old)
+	fn()
+}
+
+// openFile opens a file like os.OpenFile, but giving the files that it
+// creates the permissions allowed by mask instead of the process umask.
+// As the process umask is left alone, the permissions are set after
+// creating the file.
+func openFile(path string, flag int, mask os.FileMode) (*os.File, error) {
+	perm := 0666 &^ mask
+	created := false
+	if flag&os.O_CREATE != 0 {
+		_, err := os.Stat(path)
+		created = os.IsNotExist(err)
+	}
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil || !created {
+		return f, err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseUmask parses the argument to the umask builtin, which may be
+// an octal number like 022 or a symbolic mode like u=rwx,g=rx,o=. The
+// symbolic form describes the permissions to allow, and it is relative
+// to the current mask.
+func parseUmask(arg string, mask os.FileMode) (os.FileMode, error) {
+	if arg != "" && '0' <= arg[0] && arg[0] <= '9' {
+		n, err := strconv.ParseUint(arg, 8, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%s: octal number out of range", arg)
+		}
+		return os.FileMode(n) & os.ModePerm, nil
+	}
+	perm := os.ModePerm &^ mask
+	for _, clause := range strings.Split(arg, ",") {
+		var who os.FileMode
+		i := 0
+	who:
+		for ; i < len(clause); i++ {
+			switch clause[i] {
+			case 'u':
+				who |= 0700
+			case 'g':
+				who |= 0070
+			case 'o':
+				who |= 0007
+			case 'a':
+				who |= 0777
+			default:
+				break who
+			}
+		}
+		if who == 0 {
+			who = 0777
+		}
+		if i == len(clause) {
+			return 0, fmt.Errorf("%s: invalid symbolic mode operator", arg)
+		}
+		for i < len(clause) {
+			op := clause[i]
+			if op != '=' && op != '+' && op != '-' {
+				return 0, fmt.Errorf("`%c': invalid symbolic mode operator", op)
+			}
+			var bits os.FileMode
+			for i++; i < len(clause); i++ {
+				c := clause[i]
+				if c == '=' || c == '+' || c == '-' {
+					break
+				}
+				switch c {
+				case 'r':
+					bits |= 0444
+				case 'w':
+					bits |= 0222
+				case 'x':
+					bits |= 0111
+				default:
+					return 0, fmt.Errorf("`%c': invalid symbolic mode character", c)
+				}
+			}
+			bits &= who
+			switch op {
+			case '=':
+				perm = perm&^who | bits
+			case '+':
+				perm |= bits
+			case '-':
+				perm &^= bits
+			}
+		}
+	}
+	return os.ModePerm &^ perm, nil
+}
+
+// symbolicUmask formats a mask like umask -S, listing the permissions
+// that it allows.
+func symbolicUmask(mask os.FileMode) string {
+	perm := os.ModePerm &^ mask
+	var buf bytes.Buffer
+	for i, who := range "ugo" {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteRune(who)
+		buf.WriteByte('=')
+		shift := uint(6 - 3*i)
+		for j, c := range "rwx" {
+			if perm>>shift&(4>>uint(j)) != 0 {
+				buf.WriteRune(c)
+			}
+		}
+	}
+	return buf.String()
+}
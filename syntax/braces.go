@@ -0,0 +1,212 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import "strconv"
+
+// SplitBraces parses the brace expressions within a word, such as
+// "{a,b}" or "{1..10}", and returns a copy of the word where they are
+// represented by *BraceExp nodes. Braces that do not form a valid
+// brace expression, like "{a}" or an unmatched "{", are left as
+// literals.
+//
+// If the word contains no brace expressions, it is returned as-is
+// along with false.
+func SplitBraces(word *Word) (*Word, bool) {
+	any := false
+	top := &Word{}
+	acc := top
+	var open []*BraceExp
+
+	addLit := func(pos Pos, val string) {
+		acc.Parts = append(acc.Parts, &Lit{
+			ValuePos: pos,
+			ValueEnd: pos + Pos(len(val)),
+			Value:    val,
+		})
+	}
+	// endElem makes sure that the element being accumulated is not
+	// empty, so that its position is known.
+	endElem := func(pos Pos) {
+		if len(acc.Parts) == 0 {
+			addLit(pos, "")
+		}
+	}
+	newElem := func(br *BraceExp) {
+		acc = &Word{}
+		br.Elems = append(br.Elems, acc)
+	}
+	pop := func() *BraceExp {
+		br := open[len(open)-1]
+		open = open[:len(open)-1]
+		if len(open) == 0 {
+			acc = top
+		} else {
+			cur := open[len(open)-1]
+			acc = cur.Elems[len(cur.Elems)-1]
+		}
+		return br
+	}
+	// joinElems returns the parts of a brace expression's elements,
+	// joined by the separators they were written with.
+	joinElems := func(br *BraceExp) []WordPart {
+		sep := ","
+		if br.Sequence {
+			sep = ".."
+		}
+		var parts []WordPart
+		for i, elem := range br.Elems {
+			if i > 0 {
+				pos := br.Elems[i-1].End()
+				parts = append(parts, &Lit{
+					ValuePos: pos,
+					ValueEnd: pos + Pos(len(sep)),
+					Value:    sep,
+				})
+			}
+			parts = append(parts, elem.Parts...)
+		}
+		return parts
+	}
+	// literal returns a brace expression to the literal parts it
+	// was made of.
+	literal := func(br *BraceExp, closed bool) {
+		addLit(br.Lbrace, "{")
+		acc.Parts = append(acc.Parts, joinElems(br)...)
+		if closed {
+			addLit(br.Rbrace, "}")
+		}
+	}
+
+	for _, wp := range word.Parts {
+		lit, ok := wp.(*Lit)
+		if !ok {
+			acc.Parts = append(acc.Parts, wp)
+			continue
+		}
+		last := 0
+		for j := 0; j < len(lit.Value); j++ {
+			pos := lit.ValuePos + Pos(j)
+			addPrev := func() {
+				if last < j {
+					addLit(lit.ValuePos+Pos(last), lit.Value[last:j])
+				}
+			}
+			var cur *BraceExp
+			if len(open) > 0 {
+				cur = open[len(open)-1]
+			}
+			switch lit.Value[j] {
+			case '\\':
+				j++ // skip the escaped character
+				continue
+			case '{':
+				addPrev()
+				br := &BraceExp{Lbrace: pos}
+				open = append(open, br)
+				newElem(br)
+			case ',':
+				if cur == nil {
+					continue
+				}
+				addPrev()
+				endElem(pos)
+				if cur.Sequence {
+					// {a..b,c} has the elements "a..b" and "c"
+					joined := &Word{Parts: joinElems(cur)}
+					cur.Sequence = false
+					cur.Elems = []*Word{joined}
+				}
+				newElem(cur)
+			case '.':
+				if cur == nil || j+1 >= len(lit.Value) || lit.Value[j+1] != '.' {
+					continue
+				}
+				if len(cur.Elems) > 1 && !cur.Sequence {
+					continue // {a,b..c} has the element "b..c"
+				}
+				addPrev()
+				endElem(pos)
+				cur.Sequence = true
+				newElem(cur)
+				j++
+			case '}':
+				if cur == nil {
+					continue
+				}
+				addPrev()
+				endElem(pos)
+				br := pop()
+				br.Rbrace = pos
+				if validBraces(br) {
+					any = true
+					acc.Parts = append(acc.Parts, br)
+				} else {
+					literal(br, true)
+				}
+			default:
+				continue
+			}
+			last = j + 1
+		}
+		if last == 0 {
+			acc.Parts = append(acc.Parts, lit)
+		} else if last < len(lit.Value) {
+			addLit(lit.ValuePos+Pos(last), lit.Value[last:])
+		}
+	}
+	if !any {
+		return word, false
+	}
+	for len(open) > 0 {
+		// braces that were never closed
+		br := pop()
+		literal(br, false)
+	}
+	return top, true
+}
+
+// validBraces reports whether a brace expression is valid, i.e. it has
+// multiple elements and sequences are of either integers or letters.
+func validBraces(br *BraceExp) bool {
+	if len(br.Elems) < 2 {
+		return false
+	}
+	if !br.Sequence {
+		return true
+	}
+	if len(br.Elems) > 3 {
+		return false
+	}
+	var vals [3]string
+	for i, elem := range br.Elems {
+		if len(elem.Parts) != 1 {
+			return false
+		}
+		lit, ok := elem.Parts[0].(*Lit)
+		if !ok {
+			return false
+		}
+		vals[i] = lit.Value
+	}
+	if vals[2] != "" {
+		if _, err := strconv.Atoi(vals[2]); err != nil {
+			return false
+		}
+	}
+	_, err1 := strconv.Atoi(vals[0])
+	_, err2 := strconv.Atoi(vals[1])
+	if err1 == nil && err2 == nil {
+		return true
+	}
+	return isBraceLetter(vals[0]) && isBraceLetter(vals[1])
+}
+
+func isBraceLetter(s string) bool {
+	if len(s) != 1 {
+		return false
+	}
+	c := s[0]
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2017, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var braceTests = []struct {
+	in, want string
+}{
+	{"a", "a"},
+	{"{}", "{}"},
+	{"{a}", "{a}"},
+	{"a{b", "a{b"},
+	{"a}b", "a}b"},
+	{`\{a,b}`, `\{a,b}`},
+	{"'{a,b}'", "'{a,b}'"},
+	{"{a,b}", "(a,b)"},
+	{"x{a,b}y", "x(a,b)y"},
+	{"{,a}", "(,a)"},
+	{"{a,}", "(a,)"},
+	{"{a,{b,c}}", "(a,(b,c))"},
+	{"{a,b}{c,d}", "(a,b)(c,d)"},
+	{"{a,$b,'c d'}", "(a,$b,'c d')"},
+	{"{{a,b}", "{(a,b)"},
+	{"{a,b}}", "(a,b)}"},
+	{"{1..3}", "(1..3)"},
+	{"{01..10..3}", "(01..10..3)"},
+	{"{-3..3}", "(-3..3)"},
+	{"{a..z}", "(a..z)"},
+	{"{a..3}", "{a..3}"},
+	{"{1..3..x}", "{1..3..x}"},
+	{"{1..2..3..4}", "{1..2..3..4}"},
+	{"{ab..cd}", "{ab..cd}"},
+	{"{a..b,c}", "(a..b,c)"},
+	{"{a,b..c}", "(a,b..c)"},
+	{"{1..$n}", "{1..$n}"},
+}
+
+// braceString is like the printer, but marks brace expressions with
+// parentheses.
+func braceString(w *Word) string {
+	var buf bytes.Buffer
+	p := NewPrinter()
+	p.bufWriter.Reset(&buf)
+	for _, wp := range w.Parts {
+		br, ok := wp.(*BraceExp)
+		if !ok {
+			p.wordPart(wp)
+			p.Flush()
+			continue
+		}
+		buf.WriteByte('(')
+		for i, elem := range br.Elems {
+			if i > 0 && br.Sequence {
+				buf.WriteString("..")
+			} else if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(braceString(elem))
+		}
+		buf.WriteByte(')')
+	}
+	return buf.String()
+}
+
+func TestSplitBraces(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range braceTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			word := f.Stmts[0].Cmd.(*CallExpr).Args[0]
+			split, any := SplitBraces(word)
+			if got := braceString(split); got != tc.want {
+				t.Fatalf("SplitBraces(%q) mismatch:\nwant: %q\ngot:  %q",
+					tc.in, tc.want, got)
+			}
+			if wantAny := strings.Contains(tc.want, "("); any != wantAny {
+				t.Fatalf("SplitBraces(%q) reported %v, want %v",
+					tc.in, any, wantAny)
+			}
+			f.Stmts[0].Cmd.(*CallExpr).Args[0] = split
+			var buf bytes.Buffer
+			if err := NewPrinter().Print(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSuffix(buf.String(), "\n"); got != tc.in {
+				t.Fatalf("printing %q after SplitBraces gave %q",
+					tc.in, got)
+			}
+			Walk(split, func(node Node) bool {
+				if node != nil && !node.Pos().IsValid() {
+					t.Fatalf("invalid position for %T in %q",
+						node, tc.in)
+				}
+				return true
+			})
+		})
+	}
+}
@@ -56,6 +56,10 @@ func wordBreak(r rune) bool {
 }
 
 func (p *Parser) rune() rune {
+	if len(p.aliasBs) > 0 || p.aliasEOF {
+		return p.aliasRuneNext()
+	}
+	p.aliasRune = false
 retry:
 	if p.npos < len(p.bs) {
 		if b := p.bs[p.npos]; b < utf8.RuneSelf {
@@ -95,6 +99,24 @@ retry:
 	return p.r
 }
 
+// aliasRuneNext reads the next rune from the alias values being read,
+// or EOF if they were followed by it.
+func (p *Parser) aliasRuneNext() rune {
+	if len(p.aliasBs) == 0 {
+		p.aliasEOF, p.aliasRune = false, false
+		p.r = utf8.RuneSelf
+		return p.r
+	}
+	r, w := utf8.DecodeRune(p.aliasBs)
+	if p.litBs != nil {
+		p.litBs = append(p.litBs, p.aliasBs[:w]...)
+	}
+	p.aliasBs = p.aliasBs[w:]
+	p.aliasRune = true
+	p.r = r
+	return r
+}
+
 // fill reads more bytes from the input src into readBuf. Any bytes that
 // had not yet been used at the end of the buffer are slid into the
 // beginning of the buffer.
@@ -219,7 +241,8 @@ skipSpace:
 			break skipSpace
 		}
 	}
-	if p.pos = p.getPos(); r > utf8.RuneSelf {
+	p.tokAliasLeft = len(p.aliasBs)
+	if p.pos = p.getPos(); r > utf8.RuneSelf && !p.aliasRune {
 		p.pos -= Pos(utf8.RuneLen(r) - 1)
 	}
 	switch {
@@ -292,6 +315,12 @@ skipSpace:
 }
 
 func (p *Parser) peekByte(b byte) bool {
+	if len(p.aliasBs) > 0 {
+		return p.aliasBs[0] == b
+	}
+	if p.aliasEOF {
+		return false
+	}
 	if p.npos == len(p.bs) && p.readErr == nil {
 		p.fill()
 	}
@@ -693,6 +722,9 @@ func (p *Parser) newLit(r rune) {
 	if r <= utf8.RuneSelf {
 		p.litBs = p.litBuf[:1]
 		p.litBs[0] = byte(r)
+	} else if p.aliasRune {
+		w := utf8.EncodeRune(p.litBuf[:], r)
+		p.litBs = p.litBuf[:w]
 	} else if p.npos <= len(p.bs) {
 		w := utf8.RuneLen(r)
 		p.litBs = append(p.litBuf[:0], p.bs[p.npos-w:p.npos]...)
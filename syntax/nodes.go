@@ -350,7 +350,7 @@ func (w *Word) End() Pos { return w.Parts[len(w.Parts)-1].End() }
 // WordPart represents all nodes that can form a word.
 //
 // These are *Lit, *SglQuoted, *DblQuoted, *ParamExp, *CmdSubst,
-// *ArithmExp, *ProcSubst, and *ExtGlob.
+// *ArithmExp, *ProcSubst, *ExtGlob and *BraceExp.
 type WordPart interface {
 	Node
 	wordPartNode()
@@ -364,6 +364,7 @@ func (*CmdSubst) wordPartNode()  {}
 func (*ArithmExp) wordPartNode() {}
 func (*ProcSubst) wordPartNode() {}
 func (*ExtGlob) wordPartNode()   {}
+func (*BraceExp) wordPartNode()  {}
 
 // Lit represents an unquoted string consisting of characters that were
 // not tokenized.
@@ -701,6 +702,21 @@ type ExtGlob struct {
 func (e *ExtGlob) Pos() Pos { return e.OpPos }
 func (e *ExtGlob) End() Pos { return e.Pattern.End() + 1 }
 
+// BraceExp represents a Bash brace expression, such as "{a,b}" or
+// "{1..10..2}". Each of the elements is a non-empty word, although
+// it may only consist of an empty Lit like in "{,a}".
+//
+// This node will never appear when parsing a program on its own; only
+// when splitting a word via SplitBraces.
+type BraceExp struct {
+	Lbrace, Rbrace Pos
+	Sequence       bool // {x..y[..incr]} instead of {x,y[,...]}
+	Elems          []*Word
+}
+
+func (b *BraceExp) Pos() Pos { return b.Lbrace }
+func (b *BraceExp) End() Pos { return b.Rbrace + 1 }
+
 // ProcSubst represents a Bash process substitution.
 //
 // This node will never appear when in PosixConformant mode.
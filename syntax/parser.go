@@ -25,6 +25,20 @@ func Variant(l LangVariant) func(*Parser) {
 	return func(p *Parser) { p.lang = l }
 }
 
+// ExpandAliases makes the parser replace the first word of each simple
+// command with the value of the alias that it names, as returned by
+// lookup, like shells do. The value is parsed as if it had been in the
+// source instead of the word, so it may contain any syntax, such as
+// multiple commands or the start of a compound one. If the value ends
+// with a blank, the next word is checked for an alias too. An alias is
+// never expanded within its own value.
+//
+// All the nodes parsed from an alias value have the position of the
+// word that was replaced.
+func ExpandAliases(lookup func(name string) (string, bool)) func(*Parser) {
+	return func(p *Parser) { p.aliasLookup = lookup }
+}
+
 func NewParser(options ...func(*Parser)) *Parser {
 	p := &Parser{helperBuf: new(bytes.Buffer)}
 	for _, opt := range options {
@@ -57,6 +71,59 @@ func (p *Parser) Parse(src io.Reader, name string) (*File, error) {
 	return p.f, p.err
 }
 
+// Stmts reads and parses a shell program with an optional name, like
+// Parse. Unlike Parse, it calls fn with the statements of each line as
+// soon as the line is complete, before reading any further. This is
+// how shells run programs, and it matters when running the statements
+// changes how the following ones are parsed, such as with
+// ExpandAliases. fn is also given the file being parsed, which
+// contains all the statements so far. If fn returns false, parsing
+// stops early.
+func (p *Parser) Stmts(src io.Reader, name string, fn func(*File, []*Stmt) bool) (*File, error) {
+	p.reset()
+	p.f = &File{Name: name, lines: make([]Pos, 1, 32)}
+	p.src = src
+	p.rune()
+	p.next()
+	var line []*Stmt
+	gotEnd := true
+	for {
+		if p.tok == _EOF && p.err == nil {
+			// EOF immediately after heredoc word so no
+			// newline to trigger it
+			p.doHeredocs()
+		}
+		if (p.newLine || p.tok == _EOF) && len(line) > 0 && p.err == nil {
+			p.f.Stmts = append(p.f.Stmts, line...)
+			if !fn(p.f, line) {
+				break
+			}
+			line = nil
+		}
+		if p.tok == _EOF {
+			break
+		}
+		switch p.tok {
+		case dblSemicolon, semiAnd, dblSemiAnd, semiOr:
+			p.curErr("%s can only be used in a case clause", p.tok)
+		}
+		if !p.newLine && !gotEnd {
+			p.curErr("statements must be separated by &, ; or a newline")
+		}
+		if p.tok == _EOF {
+			break
+		}
+		s, end := p.getStmt(true, false)
+		if s == nil {
+			p.invalidStmtStart()
+			continue
+		}
+		line = append(line, s)
+		gotEnd = end
+	}
+	return p.f, p.err
+}
+
 type Parser struct {
 	src io.Reader
 	bs  []byte // current chunk of read bytes
@@ -83,6 +150,26 @@ type Parser struct {
 	keepComments bool
 	lang         LangVariant
 
+	aliasLookup func(name string) (string, bool)
+
+	// the rest of the alias values being read, which come before
+	// the rest of the source
+	aliasBs []byte
+	// the position of the word that the alias values replaced
+	aliasPos Pos
+	// whether the alias values were followed by EOF
+	aliasEOF bool
+	// whether the last rune was read from aliasBs
+	aliasRune bool
+	// the aliases whose values are being read
+	aliasStack []aliasFrame
+	// whether the next word after an alias value ending in a blank
+	// must be checked for an alias too
+	aliasBlank bool
+	// len(aliasBs) after reading the first rune of the current token,
+	// to tell whether it is part of the alias values
+	tokAliasLeft int
+
 	forbidNested bool
 
 	// list of pending heredoc bodies
@@ -112,9 +199,73 @@ func (p *Parser) reset() {
 	p.r, p.err, p.readErr = 0, nil, nil
 	p.quote, p.forbidNested = noState, false
 	p.heredocs, p.buriedHdocs = p.heredocs[:0], 0
+	p.aliasBs, p.aliasEOF, p.aliasRune = nil, false, false
+	p.aliasStack, p.aliasBlank = p.aliasStack[:0], false
 }
 
-func (p *Parser) getPos() Pos { return Pos(p.offs + p.npos) }
+func (p *Parser) getPos() Pos {
+	if len(p.aliasBs) > 0 {
+		return p.aliasPos
+	}
+	return Pos(p.offs + p.npos)
+}
+
+// An aliasFrame is an alias whose value is being read. Once there are
+// fewer than end bytes left in aliasBs, its value has been read.
+type aliasFrame struct {
+	name string
+	end  int
+}
+
+// expandAlias replaces the current word with the value of the alias
+// that it names, if any. The lexer then reads the value followed by
+// the rest of the input, and the first token in the value is read. It
+// reports whether an alias was expanded.
+func (p *Parser) expandAlias() bool {
+	for len(p.aliasStack) > 0 && p.tokAliasLeft < p.aliasStack[len(p.aliasStack)-1].end {
+		p.aliasStack = p.aliasStack[:len(p.aliasStack)-1]
+	}
+	for _, frame := range p.aliasStack {
+		if frame.name == p.val {
+			return false
+		}
+	}
+	val, ok := p.aliasLookup(p.val)
+	if !ok {
+		return false
+	}
+	if len(p.aliasBs) == 0 {
+		p.aliasPos = p.pos
+	}
+	// the rune after the word was already read, so it must be read
+	// again after the value
+	end := len(p.aliasBs)
+	bs := make([]byte, 0, len(val)+utf8.UTFMax+len(p.aliasBs))
+	bs = append(bs, val...)
+	if p.r == utf8.RuneSelf {
+		p.aliasEOF = true
+	} else {
+		var rbs [utf8.UTFMax]byte
+		w := utf8.EncodeRune(rbs[:], p.r)
+		bs = append(bs, rbs[:w]...)
+		end += w
+	}
+	p.aliasBs = append(bs, p.aliasBs...)
+	p.aliasStack = append(p.aliasStack, aliasFrame{name: p.val, end: end})
+	if n := len(val); n > 0 && (val[n-1] == ' ' || val[n-1] == '\t') {
+		p.aliasBlank = true
+	}
+	p.rune()
+	p.next()
+	return true
+}
+
+// pastAliases reports whether the current token comes after the value
+// of the last alias that was expanded.
+func (p *Parser) pastAliases() bool {
+	n := len(p.aliasStack)
+	return n == 0 || p.tokAliasLeft < p.aliasStack[n-1].end
+}
 
 func (p *Parser) lit(pos Pos, val string) *Lit {
 	if len(p.litBatch) == 0 {
@@ -418,6 +569,7 @@ func (p *Parser) errPass(err error) {
 	if p.err == nil {
 		p.err = err
 		p.npos = len(p.bs) + 1
+		p.aliasBs, p.aliasEOF = nil, false
 		p.r = utf8.RuneSelf
 		p.tok = _EOF
 	}
@@ -1336,6 +1488,7 @@ func (p *Parser) getStmt(readEnd, binCmd bool) (s *Stmt, gotEnd bool) {
 }
 
 func (p *Parser) gotStmtPipe(s *Stmt) *Stmt {
+	p.aliasBlank = false
 preLoop:
 	for {
 		switch p.tok {
@@ -1357,6 +1510,11 @@ preLoop:
 	}
 	switch p.tok {
 	case _LitWord:
+		if p.aliasLookup != nil && p.expandAlias() {
+			// the value may start with assignments or
+			// redirects too
+			goto preLoop
+		}
 		switch p.val {
 		case "{":
 			s.Cmd = p.block()
@@ -1890,6 +2048,12 @@ func (p *Parser) bashFuncDecl() *FuncDecl {
 func (p *Parser) callExpr(s *Stmt, w *Word) *CallExpr {
 	ce := p.call(w)
 	for !p.newLine {
+		if p.aliasBlank && p.pastAliases() {
+			p.aliasBlank = false
+			if p.tok == _LitWord && p.expandAlias() {
+				continue
+			}
+		}
 		switch p.tok {
 		case _EOF, semicolon, and, or, andAnd, orOr, orAnd,
 			dblSemicolon, semiAnd, dblSemiAnd, semiOr:
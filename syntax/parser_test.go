@@ -1715,3 +1715,64 @@ func (r *strictStringReader) Read(p []byte) (int, error) {
 	}
 	return n, err
 }
+
+func TestParseStmts(t *testing.T) {
+	in := "a; b &\nc\nif d; then\n\te\nfi; f\n"
+	want := [][]string{{"a", "b"}, {"c"}, {"if", "f"}}
+	var got [][]string
+	p := NewParser()
+	f, err := p.Stmts(strings.NewReader(in), "", func(f *File, stmts []*Stmt) bool {
+		var names []string
+		for _, s := range stmts {
+			switch x := s.Cmd.(type) {
+			case *CallExpr:
+				names = append(names, x.Args[0].Parts[0].(*Lit).Value)
+			case *IfClause:
+				names = append(names, "if")
+			}
+		}
+		got = append(got, names)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in %q: %v", in, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Wrong lines in %q:\nwant: %q\ngot:  %q", in, want, got)
+	}
+	if len(f.Stmts) != 5 {
+		t.Fatalf("Wrong number of statements in %q: %d", in, len(f.Stmts))
+	}
+}
+
+func TestExpandAliases(t *testing.T) {
+	aliases := map[string]string{
+		"ll":  "ls -l",
+		"ls":  "ls -F",
+		"e":   "echo ",
+		"x":   "X",
+		"beg": "if a; then",
+		"two": "b; c |",
+	}
+	lookup := func(name string) (string, bool) {
+		val, ok := aliases[name]
+		return val, ok
+	}
+	in := "ll foo\ne x x\nbeg y; fi\n\\ll 'll' ll=1\ntwo d\nx"
+	want := "ls -F -l foo\necho X x\nif a; then y; fi\n\\ll 'll' ll=1\nb\nc | d\nX\n"
+	p := NewParser(ExpandAliases(lookup))
+	f, err := p.Parse(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatalf("Unexpected error in %q: %v", in, err)
+	}
+	var buf bytes.Buffer
+	if err := NewPrinter().Print(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Fatalf("Wrong expansion of %q:\nwant: %q\ngot:  %q", in, want, got)
+	}
+	if got := f.Position(f.Stmts[6].Pos()).String(); got != "6:1" {
+		t.Fatalf("Wrong position of the last alias: %s", got)
+	}
+}
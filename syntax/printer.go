@@ -319,6 +319,19 @@ func (p *Printer) wordPart(wp WordPart) {
 		p.WriteString(x.Op.String())
 		p.WriteString(x.Pattern.Value)
 		p.WriteByte(')')
+	case *BraceExp:
+		p.WriteByte('{')
+		for i, elem := range x.Elems {
+			if i > 0 && x.Sequence {
+				p.WriteString("..")
+			} else if i > 0 {
+				p.WriteByte(',')
+			}
+			for _, wp := range elem.Parts {
+				p.wordPart(wp)
+			}
+		}
+		p.WriteByte('}')
 	case *ProcSubst:
 		// avoid conflict with << and others
 		if p.wantSpace {
@@ -175,6 +175,8 @@ func Walk(node Node, f func(Node) bool) {
 		Walk(x.Value, f)
 	case *ExtGlob:
 		Walk(x.Pattern, f)
+	case *BraceExp:
+		walkWords(x.Elems, f)
 	case *ProcSubst:
 		walkStmts(x.Stmts, f)
 	case *TimeClause: